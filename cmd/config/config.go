@@ -0,0 +1,256 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/prompt"
+)
+
+// ConfigCmd gets and sets configuration options
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Get and set configuration options",
+	Long: `Get and set configuration options
+
+Inside a project the project configuration (wedeploy.ini or .we
+next to project.json) is used, unless --global is passed.`,
+	Run: configRun,
+}
+
+var getCmd = &cobra.Command{
+	Use:     "get",
+	Short:   "Prints the value of the key <key>",
+	Example: "we config get endpoint",
+	Run:     getRun,
+}
+
+var setCmd = &cobra.Command{
+	Use:     "set",
+	Short:   "Sets the key <key> to <value>",
+	Example: "we config set --global notify_updates false",
+	Run:     setRun,
+}
+
+var unsetCmd = &cobra.Command{
+	Use:     "unset",
+	Short:   "Removes the key <key>",
+	Example: "we config unset release_channel",
+	Run:     unsetRun,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all keys and values",
+	Run:   listRun,
+}
+
+// DoctorCmd validates the configuration files and offers repairs
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Validates the configuration files and offers repairs",
+	Long: `Validates the configuration files and offers repairs
+
+A copy of each repaired file is kept with the .bak extension.`,
+	Run: doctorRun,
+}
+
+var (
+	global      bool
+	showSecrets bool
+	yes         bool
+)
+
+const secretMask = "********"
+
+func configRun(cmd *cobra.Command, args []string) {
+	if err := cmd.Help(); err != nil {
+		panic(err)
+	}
+}
+
+func getRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		println("This command takes 1 argument.")
+		os.Exit(1)
+	}
+
+	var name = args[0]
+	var value, err = getConfig().Get(name)
+
+	if err != nil {
+		keyErrorFeedback(name, err)
+	}
+
+	if key, _ := config.GetKey(name); key.Secret && !showSecrets {
+		println("fatal: " + name + " is a secret. Use --show-secrets to print it.")
+		os.Exit(1)
+	}
+
+	fmt.Println(value)
+}
+
+func setRun(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		println("This command takes 2 arguments.")
+		os.Exit(1)
+	}
+
+	var c = getConfig()
+
+	if err := c.Set(args[0], args[1]); err != nil {
+		keyErrorFeedback(args[0], err)
+	}
+
+	c.Save()
+}
+
+func unsetRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		println("This command takes 1 argument.")
+		os.Exit(1)
+	}
+
+	var c = getConfig()
+
+	if err := c.Unset(args[0]); err != nil {
+		keyErrorFeedback(args[0], err)
+	}
+
+	c.Save()
+}
+
+func listRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	var c = getConfig()
+
+	for _, key := range config.Keys() {
+		var value, err = c.Get(key.Name)
+
+		if err == config.ErrKeyNotSet {
+			continue
+		}
+
+		if key.Secret && value != "" && !showSecrets {
+			value = secretMask
+		}
+
+		fmt.Printf("%s = %s\n", key.Name, value)
+	}
+}
+
+func doctorRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	var healthy = doctor(config.Global.Path, false)
+
+	if !global && config.Context.ProjectConfig != "" &&
+		config.Context.ProjectConfig != config.Global.Path {
+		healthy = doctor(config.Context.ProjectConfig, true) && healthy
+	}
+
+	if !healthy {
+		os.Exit(1)
+	}
+}
+
+func doctor(path string, project bool) bool {
+	var problems, err = config.Diagnose(path, project)
+
+	switch {
+	case os.IsNotExist(err):
+		fmt.Println("No configuration file at " + path + ".")
+		return true
+	case err != nil:
+		println("fatal: " + err.Error())
+		return false
+	case len(problems) == 0:
+		fmt.Println("No problems found on " + path + ".")
+		return true
+	}
+
+	fmt.Printf("Problems found on %v:\n", path)
+
+	var repairable = []config.Problem{}
+
+	for _, p := range problems {
+		if !p.Repairable() {
+			fmt.Printf("  %v\n", p)
+			continue
+		}
+
+		fmt.Printf("  %v (repair: %v)\n", p, p.Repair)
+		repairable = append(repairable, p)
+	}
+
+	if len(repairable) == 0 ||
+		(!yes && !prompt.Confirm("Repair "+path+"?")) {
+		return false
+	}
+
+	var backup string
+
+	if backup, err = config.Repair(path, repairable); err != nil {
+		println("fatal: " + err.Error())
+		return false
+	}
+
+	fmt.Println("Repaired " + path + " (backup saved to " + backup + ").")
+	return len(repairable) == len(problems)
+}
+
+func getConfig() *config.Config {
+	if global || config.Context.ProjectRoot == "" {
+		return config.Global
+	}
+
+	if config.Project != nil {
+		return config.Project
+	}
+
+	var c = config.NewProjectConfig(config.Context.ProjectRoot)
+	c.Load()
+	return c
+}
+
+func keyErrorFeedback(name string, err error) {
+	switch err {
+	case config.ErrUnknownKey:
+		println("fatal: unknown key " + name + ".")
+	case config.ErrKeyNotSet:
+		// like git config, exit silently when the key is not set
+	default:
+		println("fatal: " + err.Error())
+	}
+
+	os.Exit(1)
+}
+
+func init() {
+	ConfigCmd.PersistentFlags().BoolVar(&global, "global", false,
+		"Use the global configuration file")
+
+	getCmd.Flags().BoolVar(&showSecrets, "show-secrets", false,
+		"Print secret values")
+
+	listCmd.Flags().BoolVar(&showSecrets, "show-secrets", false,
+		"Print secret values")
+
+	DoctorCmd.Flags().BoolVar(&yes, "yes", false,
+		"Repair without asking for confirmation")
+
+	ConfigCmd.AddCommand(getCmd)
+	ConfigCmd.AddCommand(setCmd)
+	ConfigCmd.AddCommand(unsetCmd)
+	ConfigCmd.AddCommand(listCmd)
+	ConfigCmd.AddCommand(DoctorCmd)
+}
@@ -0,0 +1,167 @@
+package cmdconvert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/containers"
+	"github.com/wedeploy/cli/schema"
+)
+
+// ConvertCmd converts project and container definitions between formats
+var ConvertCmd = &cobra.Command{
+	Use:   "convert [path...]",
+	Short: "Converts project and container definitions between JSON, YAML and TOML",
+	Long: `Converts project and container definitions between JSON, YAML and TOML
+
+The definition of the current container (or project) is converted,
+unless paths or --all are given. The original file is replaced.
+Comments aren't kept.`,
+	Run: convertRun,
+	Example: `we convert --to yaml
+we convert --to toml email
+we convert --to json --all
+we convert --to yaml --stdout`,
+}
+
+var (
+	to     string
+	all    bool
+	stdout bool
+)
+
+func convertRun(cmd *cobra.Command, args []string) {
+	var ext, ok = schema.Extension(to)
+
+	if !ok {
+		println("fatal: unknown format \"" + to + "\". Use json, yaml or toml.")
+		os.Exit(1)
+	}
+
+	for _, file := range getDefinitions(args) {
+		convert(file, ext)
+	}
+}
+
+func getDefinitions(args []string) []string {
+	var dirs = args
+
+	switch {
+	case all && len(args) != 0:
+		println("fatal: --all can't be used with paths")
+		os.Exit(1)
+	case all:
+		dirs = getProjectDirs()
+	case len(args) != 0:
+	case config.Context.ContainerRoot != "":
+		dirs = []string{config.Context.ContainerRoot}
+	case config.Context.ProjectRoot != "":
+		dirs = []string{config.Context.ProjectRoot}
+	default:
+		println("fatal: not inside a project")
+		os.Exit(1)
+	}
+
+	var files = []string{}
+
+	for _, dir := range dirs {
+		var file, err = schema.FindDefinition(dir)
+
+		if err != nil {
+			println("fatal: " + err.Error())
+			os.Exit(1)
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+func getProjectDirs() []string {
+	if config.Context.ProjectRoot == "" {
+		println("fatal: not inside a project")
+		os.Exit(1)
+	}
+
+	var list, err = containers.GetListFromDirectory(config.Context.ProjectRoot)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	var dirs = []string{config.Context.ProjectRoot}
+
+	for _, c := range list {
+		dirs = append(dirs, filepath.Join(config.Context.ProjectRoot, c))
+	}
+
+	return dirs
+}
+
+func convert(file, ext string) {
+	if filepath.Ext(file) == ext && !stdout {
+		fmt.Printf("%v is already %v.\n", file, schema.Format(file))
+		return
+	}
+
+	var dest, content, err = schema.Convert(file, ext)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	if stdout {
+		fmt.Print(string(content))
+		return
+	}
+
+	switch err = writeNewFile(dest, content); {
+	case os.IsExist(err):
+		println("fatal: " + dest + " already exists: remove it to convert " + file + ".")
+		os.Exit(1)
+	case err == nil:
+		err = os.Remove(file)
+	}
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Converted %v to %v.\n", file, dest)
+}
+
+// writeNewFile writes a file that must not exist,
+// so a definition is never replaced by the conversion of another one
+func writeNewFile(name string, content []byte) error {
+	var f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+
+	return f.Close()
+}
+
+func init() {
+	ConvertCmd.Flags().StringVar(&to, "to", "",
+		"Format to convert to: json, yaml or toml")
+
+	ConvertCmd.Flags().BoolVar(&all, "all", false,
+		"Convert the project and all its containers")
+
+	ConvertCmd.Flags().BoolVar(&stdout, "stdout", false,
+		"Print the converted definition instead of replacing the file")
+}
@@ -0,0 +1,258 @@
+package cmdenv
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/containers"
+	"github.com/wedeploy/cli/secrets"
+)
+
+// EnvCmd manages the environment variables of a container
+var EnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage the environment variables of a container",
+	Long: `Manage the environment variables of a container
+
+The variables are kept on the env key of the local container
+definition. Use --push to relink the container
+with the changes.`,
+	Run: envRun,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list [project] [container]",
+	Short: "Lists the environment variables",
+	Run:   listRun,
+}
+
+var getCmd = &cobra.Command{
+	Use:     "get <key> [project] [container]",
+	Short:   "Prints the value of the environment variable <key>",
+	Example: "we env get DB_HOST",
+	Run:     getRun,
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <key>=<value>... [project] [container]",
+	Short: "Sets environment variables",
+	Example: `we env set DB_HOST=db DB_PORT=5432
+we env set --file .env
+we env set LOG_LEVEL=debug --push`,
+	Run: setRun,
+}
+
+var unsetCmd = &cobra.Command{
+	Use:     "unset <key> [project] [container]",
+	Short:   "Removes the environment variable <key>",
+	Example: "we env unset LOG_LEVEL",
+	Run:     unsetRun,
+}
+
+var (
+	push        bool
+	showSecrets bool
+	file        string
+)
+
+const secretMask = "********"
+
+func envRun(cmd *cobra.Command, args []string) {
+	if err := cmd.Help(); err != nil {
+		panic(err)
+	}
+}
+
+func listRun(cmd *cobra.Command, args []string) {
+	var _, _, c, err = cmdcontext.GetLocalContainer(args)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	var keys = make([]string, 0, len(c.Env))
+
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value = c.Env[key]
+
+		if containers.IsSecretEnv(key, value) && value != "" && !showSecrets {
+			value = secretMask
+		}
+
+		fmt.Printf("%s=%s\n", key, value)
+	}
+}
+
+func getRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project and container.")
+		os.Exit(1)
+	}
+
+	var key = args[0]
+	var _, _, c, err = cmdcontext.GetLocalContainer(args[1:])
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	var value, ok = c.Env[key]
+
+	if !ok {
+		// like we config get, exit silently when the variable is not set
+		os.Exit(1)
+	}
+
+	if containers.IsSecretEnv(key, value) && !showSecrets {
+		println("fatal: " + key + " looks like a secret. Use --show-secrets to print it.")
+		os.Exit(1)
+	}
+
+	fmt.Println(value)
+}
+
+func setRun(cmd *cobra.Command, args []string) {
+	var changes = map[string]string{}
+
+	if file != "" {
+		changes = readEnvFile(file)
+	}
+
+	for len(args) != 0 && strings.Contains(args[0], "=") {
+		var kv = strings.SplitN(args[0], "=", 2)
+
+		if !containers.ValidEnvKey(kv[0]) {
+			println("fatal: invalid environment variable name " + kv[0] + ".")
+			os.Exit(1)
+		}
+
+		changes[kv[0]] = kv[1]
+		args = args[1:]
+	}
+
+	if len(changes) == 0 {
+		println("This command takes <key>=<value> arguments or --file.")
+		os.Exit(1)
+	}
+
+	var project, path, err = cmdcontext.GetLocalContainerPath(args)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	save(project, path, changes, nil)
+}
+
+func unsetRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project and container.")
+		os.Exit(1)
+	}
+
+	var key = args[0]
+	var project, path, err = cmdcontext.GetLocalContainerPath(args[1:])
+	var c *containers.Container
+
+	if err == nil {
+		c, err = containers.ReadRaw(path)
+	}
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	if _, ok := c.Env[key]; !ok {
+		os.Exit(1)
+	}
+
+	save(project, path, nil, []string{key})
+}
+
+func readEnvFile(name string) map[string]string {
+	var f, err = os.Open(name)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	defer f.Close()
+
+	var env map[string]string
+
+	if env, err = containers.ParseEnvFile(f); err != nil {
+		println("fatal: " + name + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	return env
+}
+
+// save changes only the given variables on the definition, which isn't resolved
+func save(project, path string, set map[string]string, unset []string) {
+	if err := containers.UpdateEnv(path, set, unset); err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	if !push {
+		return
+	}
+
+	var c, err = containers.Read(path)
+
+	if err != nil {
+		println("fatal: can't push the changes: " + err.Error())
+		os.Exit(1)
+	}
+
+	var pushed = *c
+
+	if pushed.Env, err = secrets.Decrypted(project, c.Env); err == nil {
+		err = containers.Link(project, path, &pushed)
+	}
+
+	if err != nil {
+		println("fatal: can't push the changes: " + err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Container %v relinked with the new environment.\n", c.ID)
+}
+
+func init() {
+	setCmd.Flags().StringVar(&file, "file", "",
+		"Import the variables of an .env file")
+
+	setCmd.Flags().BoolVar(&push, "push", false,
+		"Relink the container with the changes")
+
+	unsetCmd.Flags().BoolVar(&push, "push", false,
+		"Relink the container with the changes")
+
+	getCmd.Flags().BoolVar(&showSecrets, "show-secrets", false,
+		"Print secret values")
+
+	listCmd.Flags().BoolVar(&showSecrets, "show-secrets", false,
+		"Print secret values")
+
+	EnvCmd.AddCommand(listCmd)
+	EnvCmd.AddCommand(getCmd)
+	EnvCmd.AddCommand(setCmd)
+	EnvCmd.AddCommand(unsetCmd)
+}
@@ -1,27 +1,49 @@
 package cmdlink
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/wedeploy/cli/cmdcontext"
 	"github.com/wedeploy/cli/config"
 	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/link"
+	"github.com/wedeploy/cli/prompt"
 )
 
 // LinkCmd links the given project or container locally
 var LinkCmd = &cobra.Command{
 	Use:   "link",
 	Short: "Links the given project or container locally",
-	Run:   linkRun,
+	Long: `Links the given project or container locally
+
+The overlay of the environment given by --environment, such as
+container.production.json, is merged over the definitions.
+Then ${VAR} and ${VAR:-default} variables on their strings are replaced
+by the process environment variables or the variables of the --vars file.
+Use $$ for a literal $, such as "PRICE": "$$5". Hooks aren't interpolated.
+Variables that aren't set are kept as written, with a warning.`,
+	Run: linkRun,
 	Example: `we link
 we link <project>
-we link <container>`,
+we link <container>
+we link --watch
+we link --dry-run
+we link --prune`,
 }
 
+var (
+	watch    bool
+	dryRun   bool
+	prune    bool
+	yes      bool
+	parallel int
+)
+
 func getContainersFromScope() []string {
 	if config.Context.ContainerRoot != "" {
 		_, container := filepath.Split(config.Context.ContainerRoot)
@@ -50,7 +72,13 @@ func linkRun(cmd *cobra.Command, args []string) {
 	getProjectOrContainerID(args)
 	var list = getContainersFromScope()
 
+	if dryRun {
+		planRun(list)
+		return
+	}
+
 	var m = &link.Machine{
+		Parallel:   parallel,
 		FErrStream: os.Stderr,
 		FOutStream: os.Stdout,
 	}
@@ -62,11 +90,110 @@ func linkRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	m.Run(list)
+	var ctx = cmdcontext.SignalContext()
+
+	m.RunContext(ctx, list)
+
+	if ctx.Err() != nil {
+		canceledFeedback(m)
+	}
+
+	if prune {
+		pruneRun(m)
+	}
+
+	if watch {
+		watchRun(ctx, m, list)
+		return
+	}
 
 	linkContainersFeedback(m.Success, m.Errors)
 }
 
+func canceledFeedback(m *link.Machine) {
+	var pending = []string{}
+
+	for _, e := range m.Errors.List {
+		if e.Error == context.Canceled {
+			pending = append(pending, e.ContainerPath)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "\nLinking canceled.")
+
+	if len(m.Linked) != 0 {
+		fmt.Fprintln(os.Stderr, "Linked:", strings.Join(m.Linked, ", "))
+	}
+
+	if len(pending) != 0 {
+		fmt.Fprintln(os.Stderr, "Not linked:", strings.Join(pending, ", "))
+	}
+
+	os.Exit(130)
+}
+
+func planRun(list []string) {
+	var plan, err = link.GetPlan(config.Context.ProjectRoot, list)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	plan.Prune = prune
+	plan.Print(os.Stdout)
+}
+
+// pruneRun unlinks the remote containers with no local definition
+func pruneRun(m *link.Machine) {
+	if len(m.Errors.List) != 0 {
+		fmt.Fprintln(os.Stderr, "Not pruning: some containers failed to link.")
+		return
+	}
+
+	var orphans, err = link.Orphans(config.Context.ProjectRoot, m.Project.ID)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(orphans) == 0 {
+		return
+	}
+
+	fmt.Println("Remote containers not present locally will be unlinked:")
+
+	for _, id := range orphans {
+		fmt.Printf("  - %v\n", id)
+	}
+
+	if !yes && !prompt.Confirm("Continue?") {
+		fmt.Println("Not pruning.")
+		return
+	}
+
+	for _, id := range orphans {
+		if err = containers.Unlink(m.Project.ID, id); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't unlink container %v: %v\n", id, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Container %v unlinked.\n", id)
+	}
+}
+
+func watchRun(ctx context.Context, m *link.Machine, list []string) {
+	fmt.Println("Watching for changes. Press Ctrl+C to stop.")
+
+	if err := m.Watch(ctx, list); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\nStopped watching.")
+}
+
 func getProjectOrContainerID(args []string) (string, string) {
 	var project, container, err = cmdcontext.GetProjectOrContainerID(args)
 
@@ -77,3 +204,20 @@ func getProjectOrContainerID(args []string) (string, string) {
 
 	return project, container
 }
+
+func init() {
+	LinkCmd.Flags().BoolVar(&watch, "watch", false,
+		"Relink containers when their files change")
+
+	LinkCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show what would be linked without changing anything")
+
+	LinkCmd.Flags().BoolVar(&prune, "prune", false,
+		"Unlink remote containers not present locally")
+
+	LinkCmd.Flags().BoolVar(&yes, "yes", false,
+		"Prune without asking for confirmation")
+
+	LinkCmd.Flags().IntVar(&parallel, "parallel", link.DefaultParallel,
+		"Number of containers to link at the same time")
+}
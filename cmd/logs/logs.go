@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/config"
 	"github.com/wedeploy/cli/logs"
 )
 
@@ -29,6 +30,10 @@ we logs portal email email5932`,
 func logsRun(cmd *cobra.Command, args []string) {
 	c := cmdcontext.SplitArguments(args, 0, 2)
 
+	if !cmd.Flags().Changed("level") && config.Global.LogLevel != "" {
+		severityArg = config.Global.LogLevel
+	}
+
 	project, container, err := cmdcontext.GetProjectAndContainerID(c)
 	level, levelErr := logs.GetLevel(severityArg)
 
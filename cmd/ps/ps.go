@@ -0,0 +1,129 @@
+package cmdps
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/henvic/uilive"
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/containers"
+)
+
+// PsCmd lists the instances of a project or container
+var PsCmd = &cobra.Command{
+	Use:   "ps [project] [container]",
+	Short: "Lists the instances of a project or container",
+	Run:   psRun,
+	Example: `we ps portal
+we ps portal email
+we ps --watch
+we ps --output json`,
+}
+
+var (
+	watch  bool
+	output string
+)
+
+// RefreshInterval is how often the instances are listed again with --watch
+var RefreshInterval = 2 * time.Second
+
+func psRun(cmd *cobra.Command, args []string) {
+	var project, container, err = cmdcontext.GetProjectOrContainerID(args)
+
+	if err != nil {
+		if err = cmd.Help(); err != nil {
+			panic(err)
+		}
+		os.Exit(1)
+	}
+
+	switch {
+	case output != "text" && output != "json":
+		println("fatal: unknown output format " + output + ". Use text or json.")
+		os.Exit(1)
+	case watch && output == "json":
+		println("fatal: --watch can't be used with --output json.")
+		os.Exit(1)
+	case watch:
+		watchRun(project, container)
+	default:
+		printRun(project, container)
+	}
+}
+
+func getInstances(project, container string) ([]containers.Instance, error) {
+	if container == "" {
+		return containers.GetProjectInstances(project)
+	}
+
+	return containers.GetInstances(project, container)
+}
+
+func printRun(project, container string) {
+	var instances, err = getInstances(project, container)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	if output == "text" {
+		containers.PrintInstances(os.Stdout, instances, time.Now())
+		return
+	}
+
+	if instances == nil {
+		instances = []containers.Instance{}
+	}
+
+	var bin, _ = json.MarshalIndent(instances, "", "    ")
+	fmt.Println(string(bin))
+}
+
+func watchRun(project, container string) {
+	var ctx = cmdcontext.SignalContext()
+	var livew = uilive.New()
+	var ticker = time.NewTicker(RefreshInterval)
+
+	defer ticker.Stop()
+	livew.Start()
+
+	for {
+		var buf bytes.Buffer
+		var instances, err = getInstances(project, container)
+
+		switch err {
+		case nil:
+			containers.PrintInstances(&buf, instances, time.Now())
+		default:
+			fmt.Fprintf(&buf, "Can't list the instances: %v\n", err)
+		}
+
+		fmt.Fprintf(&buf, "\nUpdated at %v. Press Ctrl+C to stop.\n",
+			time.Now().Format("15:04:05"))
+
+		if _, err = livew.Write(buf.Bytes()); err != nil {
+			panic(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			livew.Stop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func init() {
+	PsCmd.Flags().BoolVar(&watch, "watch", false,
+		"Refresh the list in place")
+
+	PsCmd.Flags().StringVarP(&output, "output", "o", "text",
+		"Output format: text or json")
+}
@@ -3,9 +3,12 @@ package cmdremote
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/remote"
 	"github.com/wedeploy/cli/verbose"
 )
 
@@ -49,6 +52,19 @@ var setURLCmd = &cobra.Command{
 	Run:   setURLRun,
 }
 
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks the health of the remotes (or of the remote named [name])",
+	Long: `Checks the health of the remotes (or of the remote named [name])
+
+Reports reachability, TLS certificate, API version, latency
+and whether the stored credentials are accepted.
+Credentials are only checked on the remote of your endpoint, over https.
+Exits with a non-zero status if any remote fails the check.`,
+	Example: "we remote check staging",
+	Run:     checkRun,
+}
+
 func remoteRun(cmd *cobra.Command, args []string) {
 	if len(args) != 0 {
 		println("This command doesn't take arguments.")
@@ -172,10 +188,104 @@ func setURLRun(cmd *cobra.Command, args []string) {
 	global.Save()
 }
 
+func checkRun(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		println("This command takes 0 or 1 argument.")
+		os.Exit(1)
+	}
+
+	var global = config.Global
+	var list = []remote.Remote{}
+
+	for _, name := range global.Remotes.List() {
+		if len(args) == 0 || args[0] == name {
+			var r, _ = global.Remotes.Get(name)
+			list = append(list, remote.Remote{Name: name, URL: r.URL})
+		}
+	}
+
+	switch {
+	case len(args) == 1 && len(list) == 0:
+		println("fatal: remote " + args[0] + " doesn't exists.")
+		os.Exit(1)
+	case len(list) == 0:
+		fmt.Println("No remotes configured.")
+		return
+	}
+
+	var checker = &remote.Checker{
+		Credentials: remote.Credentials{
+			Endpoint: global.Endpoint,
+			Username: global.Username,
+			Password: global.Password,
+			Token:    global.Token,
+		},
+	}
+
+	var failed = false
+
+	for _, r := range checker.Check(list) {
+		printCheck(r)
+		failed = failed || !r.OK()
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printCheck(r remote.Result) {
+	var status = color.GreenString("ok")
+
+	if !r.OK() {
+		status = color.RedString("failed")
+	}
+
+	fmt.Printf("%s\t%s\t%s\n", r.Name, r.URL, status)
+
+	if !r.Reachable {
+		fmt.Printf("\treachable: no (%v)\n", r.Err)
+		return
+	}
+
+	fmt.Printf("\tlatency: %v\n", r.Latency.Round(time.Millisecond))
+	printCertificate(r.Certificate)
+
+	if r.Err != nil {
+		fmt.Printf("\terror: %v\n", r.Err)
+		return
+	}
+
+	var version = r.APIVersion
+
+	if version == "" {
+		version = "unknown"
+	}
+
+	fmt.Printf("\tapi version: %v\n", version)
+	fmt.Printf("\tcredentials: %v\n", r.Credentials)
+}
+
+func printCertificate(c *remote.Certificate) {
+	switch {
+	case c == nil:
+		fmt.Println("\ttls: no")
+	case !c.Valid:
+		fmt.Println("\ttls: invalid certificate")
+	case c.ExpiresSoon(time.Now()):
+		fmt.Printf("\ttls: valid, %s\n", color.YellowString(
+			"expires soon (%v)", c.NotAfter.Format("2006-01-02")))
+	default:
+		fmt.Printf("\ttls: valid until %v (%v)\n",
+			c.NotAfter.Format("2006-01-02"), c.Issuer)
+	}
+}
+
 func init() {
 	RemoteCmd.AddCommand(addCmd)
 	RemoteCmd.AddCommand(renameCmd)
 	RemoteCmd.AddCommand(removeCmd)
 	RemoteCmd.AddCommand(getURLCmd)
 	RemoteCmd.AddCommand(setURLCmd)
+	RemoteCmd.AddCommand(checkCmd)
 }
@@ -0,0 +1,88 @@
+package cmdresolve
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/schema"
+)
+
+// ResolveCmd prints a resolved project or container definition
+var ResolveCmd = &cobra.Command{
+	Use:   "resolve [path]",
+	Short: "Prints the resolved definition of a container or project",
+	Long: `Prints the resolved definition of a container or project
+
+The overlay of the environment given by --environment, such as
+container.production.json, is merged over the definition.
+The flag is --environment and not --env, which sets the variables of "we run".
+Then ${VAR} and ${VAR:-default} variables on its strings are replaced
+by the process environment variables or the variables of the --vars file.
+Use $$ for a literal $. Hooks aren't interpolated.
+Variables that aren't set are kept as written: "we validate" warns about them.`,
+	Run: resolveRun,
+	Example: `we resolve
+we resolve email --environment production
+we resolve --environment staging --vars staging.env
+we resolve -o yaml`,
+}
+
+var output string
+
+func resolveRun(cmd *cobra.Command, args []string) {
+	var ext, ok = schema.Extension(output)
+
+	if !ok {
+		println("fatal: unknown output format " + output + ". Use json, yaml or toml.")
+		os.Exit(1)
+	}
+
+	if len(args) > 1 {
+		if err := cmd.Help(); err != nil {
+			panic(err)
+		}
+		os.Exit(1)
+	}
+
+	var file, err = schema.FindDefinition(getPath(args))
+	var n *schema.Node
+
+	if err == nil {
+		n, err = schema.Resolve(file)
+	}
+
+	var content []byte
+
+	if err == nil {
+		content, err = schema.Encode("definition"+ext, n)
+	}
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Print(string(content))
+}
+
+func getPath(args []string) string {
+	switch {
+	case len(args) != 0:
+		return args[0]
+	case config.Context.ContainerRoot != "":
+		return config.Context.ContainerRoot
+	case config.Context.ProjectRoot != "":
+		return config.Context.ProjectRoot
+	}
+
+	println("fatal: not inside a project")
+	os.Exit(1)
+	return ""
+}
+
+func init() {
+	ResolveCmd.Flags().StringVarP(&output, "output", "o", "json",
+		"Output format: json, yaml or toml")
+}
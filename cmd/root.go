@@ -8,47 +8,69 @@ import (
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/wedeploy/cli/cmd/auth"
+	"github.com/wedeploy/cli/cmd/config"
 	"github.com/wedeploy/cli/cmd/containers"
+	"github.com/wedeploy/cli/cmd/convert"
 	"github.com/wedeploy/cli/cmd/createctx"
+	"github.com/wedeploy/cli/cmd/env"
 	"github.com/wedeploy/cli/cmd/link"
 	"github.com/wedeploy/cli/cmd/logs"
 	"github.com/wedeploy/cli/cmd/projects"
+	"github.com/wedeploy/cli/cmd/ps"
 	"github.com/wedeploy/cli/cmd/remote"
+	"github.com/wedeploy/cli/cmd/resolve"
 	"github.com/wedeploy/cli/cmd/restart"
 	"github.com/wedeploy/cli/cmd/run"
+	"github.com/wedeploy/cli/cmd/scale"
+	"github.com/wedeploy/cli/cmd/secrets"
 	"github.com/wedeploy/cli/cmd/stop"
 	"github.com/wedeploy/cli/cmd/unlink"
 	"github.com/wedeploy/cli/cmd/update"
+	"github.com/wedeploy/cli/cmd/validate"
 	"github.com/wedeploy/cli/cmd/version"
 	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/defaults"
+	"github.com/wedeploy/cli/schema"
 	"github.com/wedeploy/cli/update"
 	"github.com/wedeploy/cli/verbose"
 )
 
 // WhitelistCmdsNoAuthentication for cmds that doesn't require authentication
 var WhitelistCmdsNoAuthentication = map[string]bool{
-	"login":   true,
-	"logout":  true,
-	"build":   true,
-	"deploy":  true,
-	"update":  true,
-	"version": true,
+	"login":    true,
+	"logout":   true,
+	"build":    true,
+	"config":   true,
+	"convert":  true,
+	"deploy":   true,
+	"resolve":  true,
+	"secrets":  true,
+	"update":   true,
+	"validate": true,
+	"version":  true,
 }
 
 // ListNoRemoteFlags hides the globals non used --remote and --local flags
 var ListNoRemoteFlags = map[string]bool{
-	"link":    true,
-	"unlink":  true,
-	"run":     true,
-	"stop":    true,
-	"remote":  true,
-	"update":  true,
-	"version": true,
+	"config":   true,
+	"convert":  true,
+	"env":      true,
+	"link":     true,
+	"unlink":   true,
+	"run":      true,
+	"secrets":  true,
+	"stop":     true,
+	"remote":   true,
+	"resolve":  true,
+	"update":   true,
+	"validate": true,
+	"version":  true,
 }
 
 // LocalOnlyCommands sets the --local flag automatically for given commands
 var LocalOnlyCommands = map[string]bool{
+	"env":    true,
 	"link":   true,
 	"unlink": true,
 	"run":    true,
@@ -68,9 +90,11 @@ http://liferay.io`,
 }
 
 var (
-	version bool
-	local   bool
-	remote  string
+	version     bool
+	local       bool
+	remote      string
+	environment string
+	varsFile    string
 )
 
 // Execute is the Entry-point for the CLI
@@ -108,12 +132,20 @@ var commands = []*cobra.Command{
 	cmdlogs.LogsCmd,
 	cmdprojects.ProjectsCmd,
 	cmdcontainers.ContainersCmd,
+	cmdps.PsCmd,
 	cmdrestart.RestartCmd,
+	cmdscale.ScaleCmd,
 	cmdrun.RunCmd,
 	cmdstop.StopCmd,
 	cmdlink.LinkCmd,
 	cmdunlink.UnlinkCmd,
+	cmdenv.EnvCmd,
+	cmdsecrets.SecretsCmd,
+	cmdvalidate.ValidateCmd,
+	cmdconvert.ConvertCmd,
+	cmdresolve.ResolveCmd,
 	cmdremote.RemoteCmd,
+	cmdconfig.ConfigCmd,
 	cmdupdate.UpdateCmd,
 	cmdversion.VersionCmd,
 }
@@ -170,6 +202,14 @@ func init() {
 		&remote,
 		"remote", "", "Remote to use")
 
+	RootCmd.PersistentFlags().StringVar(
+		&environment,
+		"environment", "", "Environment overlay of the definitions, such as production for container.production.json")
+
+	RootCmd.PersistentFlags().StringVar(
+		&varsFile,
+		"vars", "", "File with KEY=value variables for ${KEY} on the definitions")
+
 	RootCmd.Flags().BoolVar(
 		&version,
 		"version", false, "Print version information and quit")
@@ -189,7 +229,7 @@ func init() {
 func setLocal() {
 	if os.Getenv("WEDEPLOY_OVERRIDE_LOCAL_ENDPOINT") == "" {
 		verbose.Debug("Overriding --local endpoint (explicit or not)")
-		config.Global.Endpoint = "http://localhost:8080/"
+		config.Global.Endpoint = cmdrun.LocalEndpoint()
 	}
 
 	config.Global.Token = "1"
@@ -206,11 +246,71 @@ func setRemote() {
 	config.Global.Endpoint = r.URL
 }
 
+func checkConfigErrors(cmd *cobra.Command) {
+	if cmd == cmdconfig.DoctorCmd {
+		return
+	}
+
+	for _, c := range []*config.Config{config.Global, config.Project} {
+		if c == nil || c.LoadError() == nil {
+			continue
+		}
+
+		println("Error reading configuration file:", c.LoadError().Error())
+		println("Run \"we config doctor\" to repair " + c.Path + ".")
+		os.Exit(1)
+	}
+}
+
+func reportProjectConfigConflicts() {
+	for _, o := range config.Global.Overrides() {
+		if o.Global != o.Project {
+			verbose.Debug(fmt.Sprintf(
+				"Project configuration overrides %v: %v (global: %v)",
+				o.Key, o.Project, o.Global))
+		}
+	}
+}
+
+func setDefinitionsEnvironment() {
+	if environment != "" && !schema.EnvironmentPattern.MatchString(environment) {
+		println("fatal: invalid environment name " + environment)
+		os.Exit(1)
+	}
+
+	schema.Environment = environment
+
+	if varsFile == "" {
+		return
+	}
+
+	var f, err = os.Open(varsFile)
+
+	if err == nil {
+		schema.Vars, err = containers.ParseEnvFile(f)
+		f.Close()
+	}
+
+	if err != nil {
+		println("fatal: " + varsFile + ": " + err.Error())
+		os.Exit(1)
+	}
+}
+
 func persistentPreRun(cmd *cobra.Command, args []string) {
+	checkConfigErrors(cmd)
+	reportProjectConfigConflicts()
+	setDefinitionsEnvironment()
 	cmdSetLocalFlag()
 	verifyCmdReqAuth(cmd.CommandPath())
 
+	if remote == "" {
+		remote = config.Global.Remote
+	}
+
 	switch {
+	case isRemoteCmd(cmd):
+		// the remotes are checked with the endpoint and credentials of the user
 	case local:
 		setLocal()
 	case remote != "":
@@ -218,6 +318,16 @@ func persistentPreRun(cmd *cobra.Command, args []string) {
 	}
 }
 
+func isRemoteCmd(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == cmdremote.RemoteCmd {
+			return true
+		}
+	}
+
+	return false
+}
+
 func run(cmd *cobra.Command, args []string) {
 	if version {
 		cmdversion.VersionCmd.Run(cmd, args)
@@ -230,7 +340,7 @@ func run(cmd *cobra.Command, args []string) {
 }
 
 func isCmdWhitelistNoAuth(commandPath string) bool {
-	var parts = strings.SplitAfterN(commandPath, " ", 2)
+	var parts = strings.Split(commandPath, " ")
 
 	if len(parts) < 2 {
 		return true
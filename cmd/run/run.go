@@ -1,10 +1,19 @@
 package cmdrun
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/prompt"
 	"github.com/wedeploy/cli/run"
+	"github.com/wedeploy/cli/verbose"
 )
 
 // RunCmd runs the WeDeploy infrastructure for development locally
@@ -14,10 +23,92 @@ var RunCmd = &cobra.Command{
 	Run:   runRun,
 }
 
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Removes all data of the local infrastructure",
+	Run:   resetRun,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the status of the local infrastructure",
+	Long: `Shows the status of the local infrastructure
+
+Exits with a non-zero status if the infrastructure is not ready.
+Use --wait to block until it is ready (or --timeout is reached).`,
+	Example: "we run status --wait --timeout 5m",
+	Run:     statusRun,
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Saves and restores the data of the local infrastructure",
+	Long: `Saves and restores the data of the local infrastructure
+
+Snapshots are stored as tarballs on ~/.wedeploy/snapshots
+and can be shared to reproduce a given state.`,
+	Run: snapshotRun,
+}
+
+var snapshotSaveCmd = &cobra.Command{
+	Use:     "save",
+	Short:   "Saves the data as the snapshot <name>",
+	Example: "we run snapshot save fixtures",
+	Run:     snapshotSaveRun,
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:     "restore",
+	Short:   "Replaces the data by the snapshot <name>",
+	Example: "we run snapshot restore fixtures",
+	Run:     snapshotRestoreRun,
+}
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Lists the local images of the infrastructure",
+	Run:   imagesRun,
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Pulls a newer infrastructure image and restarts it",
+	Long: `Pulls a newer infrastructure image and restarts it
+
+The image is set by the image key of the [run] section of the
+project or global configuration, as tag[@digest].
+A running infrastructure is restarted in background
+only if the image changed.`,
+	Run: upgradeRun,
+}
+
+// Exit codes for the errors of the run package
+const (
+	exitError          = 1
+	exitDockerNotFound = 3
+	exitPullFailed     = 4
+	exitAlreadyRunning = 5
+	exitNotRunning     = 6
+	exitPortConflicts  = 7
+	exitCanceled       = 130
+)
+
 var (
 	detach   bool
 	dryRun   bool
 	viewMode bool
+	fresh    bool
+	yes      bool
+	ports    []string
+	image    string
+	hostIP   string
+	memory   string
+	cpus     string
+	env      []string
+	volumes  []string
+	network  string
+	wait     bool
+	timeout  time.Duration
 )
 
 func runRun(cmd *cobra.Command, args []string) {
@@ -26,11 +117,403 @@ func runRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	run.Run(run.Flags{
+	var flags = runFlags()
+	setLocalEndpoint(flags.Ports)
+
+	if err := run.Run(cmdcontext.SignalContext(), GetDocker(), flags); err != nil {
+		Exit(err)
+	}
+}
+
+// GetDocker gets the docker backend, exiting if docker is not available
+func GetDocker() run.Docker {
+	var docker, err = run.NewDocker()
+
+	if err != nil {
+		Exit(err)
+	}
+
+	return docker
+}
+
+// Exit prints the message for an error of the run package and exits with its code
+func Exit(err error) {
+	var message, code = errorFeedback(err)
+	println(message)
+	os.Exit(code)
+}
+
+func errorFeedback(err error) (string, int) {
+	switch e := err.(type) {
+	case run.PullError:
+		return e.Error() + "\nCheck your connection and the image with \"we run images\".",
+			exitPullFailed
+	case run.PortConflictsError:
+		return e.Error() + "\nStop the processes using them " +
+			"or remap the ports with --port host:container.", exitPortConflicts
+	case run.StopError:
+		if _, ok := e.Err.(run.DockerError); ok {
+			return "warning: still stopping WeDeploy on background\n" + e.Err.Error(), exitError
+		}
+	}
+
+	switch err {
+	case run.ErrDockerNotFound:
+		return "Docker is not installed. Download it from http://docker.com/", exitDockerNotFound
+	case run.ErrAlreadyRunning:
+		return "WeDeploy is already running. Stop it first with \"we stop\".", exitAlreadyRunning
+	case run.ErrNotRunning:
+		return "WeDeploy is not running.", exitNotRunning
+	case run.ErrHostNotFound:
+		return "Could not find a suitable host.\n" +
+			"To use we run you need a suitable network interface on.\n" +
+			"Set the host IP with --host-ip if it can't be detected.", exitError
+	case context.Canceled:
+		return "Canceled.", exitCanceled
+	}
+
+	return "fatal: " + err.Error(), exitError
+}
+
+// runFlags gets the run flags from the command line and the [run] configuration
+func runFlags() run.Flags {
+	var c = config.Global.Run
+
+	return run.Flags{
 		Detach:   detach,
 		DryRun:   dryRun,
 		ViewMode: viewMode,
-	})
+		Fresh:    fresh,
+		Ports:    portMappings(),
+		Image:    imagePin(),
+		HostIP:   override(hostIP, c.HostIP),
+		Memory:   override(memory, c.Memory),
+		CPUs:     override(cpus, c.CPUs),
+		Env:      append(append([]string{}, c.Env...), env...),
+		Volumes:  append(append([]string{}, c.Volumes...), volumes...),
+		Network:  override(network, c.Network),
+	}
+}
+
+func override(flag, configured string) string {
+	if flag != "" {
+		return flag
+	}
+
+	return configured
+}
+
+func portMappings() []string {
+	var mappings = append([]string{}, config.Global.Run.Ports...)
+	return append(mappings, ports...)
+}
+
+// imagePin gets the image from --image, the project or the global configuration
+func imagePin() string {
+	switch {
+	case image != "":
+		return image
+	case config.Project != nil && config.Project.Run.Image != "":
+		return config.Project.Run.Image
+	default:
+		return config.Global.Run.Image
+	}
+}
+
+func getPin() run.Pin {
+	var pin, err = run.ParsePin(imagePin())
+
+	if err != nil {
+		Exit(err)
+	}
+
+	return pin
+}
+
+func imagesRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	var pin = getPin()
+	var images, err = run.ListImages(GetDocker())
+
+	if err != nil {
+		Exit(err)
+	}
+
+	if len(images) == 0 {
+		fmt.Println("No WeDeploy images found. Pull one with \"we run upgrade\".")
+		return
+	}
+
+	for _, i := range images {
+		var mark = " "
+
+		for _, tag := range i.RepoTags {
+			if tag == pin.Image() {
+				mark = "*"
+			}
+		}
+
+		fmt.Printf("%v %-24v%-74v%v\n", mark, strings.Join(i.RepoTags, ", "),
+			i.Digest(), shortID(i.ID))
+	}
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+func upgradeRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	var pin = getPin()
+	var docker = GetDocker()
+	var changed, err = run.Upgrade(docker, pin, os.Stdout)
+
+	if err != nil {
+		Exit(err)
+	}
+
+	var digest, ok, derr = run.CheckDigest(docker, pin)
+
+	switch {
+	case derr != nil:
+		verbose.Debug("Can't verify the image digest:", derr)
+	case !ok:
+		println(run.DigestWarning(pin, digest))
+	}
+
+	if !changed {
+		fmt.Println("WeDeploy image " + pin.Image() + " is up to date.")
+		return
+	}
+
+	fmt.Println("WeDeploy image " + pin.Image() + " upgraded.")
+	restart(docker, pin)
+}
+
+// restart the infrastructure with the upgraded image, if it is running
+func restart(docker run.Docker, pin run.Pin) {
+	var status, err = run.GetStatus(docker)
+
+	if err != nil {
+		Exit(err)
+	}
+
+	if !status.Running {
+		return
+	}
+
+	if status.Container.Image != pin.Image() {
+		fmt.Println("WeDeploy is running " + status.Container.Image +
+			". Restart it to use the upgraded image.")
+		return
+	}
+
+	fmt.Println("Restarting WeDeploy with the upgraded image.")
+
+	if err = run.Stop(docker); err != nil {
+		Exit(err)
+	}
+
+	var flags = runFlags()
+	flags.Detach = true
+	flags.Image = pin.String()
+
+	setLocalEndpoint(flags.Ports)
+
+	if err = run.Run(cmdcontext.SignalContext(), docker, flags); err != nil {
+		Exit(err)
+	}
+}
+
+func resetRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	if !yes && !prompt.Confirm(
+		"This removes all local projects and their data. Continue?") {
+		os.Exit(1)
+	}
+
+	if err := run.Reset(GetDocker()); err != nil {
+		Exit(err)
+	}
+
+	fmt.Println("WeDeploy data removed.")
+}
+
+func statusRun(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		println("This command doesn't take arguments.")
+		os.Exit(1)
+	}
+
+	var docker = GetDocker()
+	var status run.Status
+	var err error
+
+	switch wait {
+	case true:
+		status, err = run.WaitReady(docker, timeout, time.Second)
+	default:
+		status, err = run.GetStatus(docker)
+	}
+
+	if err != nil {
+		Exit(err)
+	}
+
+	printStatus(status)
+	checkStatusDigest(status)
+
+	if !status.Ready() {
+		os.Exit(1)
+	}
+}
+
+func printStatus(s run.Status) {
+	if !s.Running {
+		fmt.Println("WeDeploy is not running.")
+		return
+	}
+
+	var c = s.Container
+	var ports = []string{}
+
+	for _, p := range c.Ports {
+		ports = append(ports, p.String())
+	}
+
+	fmt.Printf("Container\t%v\n", c.ID)
+	fmt.Printf("Image\t\t%v\n", c.Image)
+
+	if digest := s.Image.Digest(); digest != "" {
+		fmt.Printf("Digest\t\t%v\n", digest)
+	}
+
+	fmt.Printf("Uptime\t\t%v\n", s.Uptime(time.Now()).Round(time.Second))
+	fmt.Printf("Ports\t\t%v\n", strings.Join(ports, ", "))
+
+	if c.Health != "" {
+		fmt.Printf("Health\t\t%v\n", c.Health)
+	}
+
+	fmt.Println("Services")
+
+	for _, service := range s.Services {
+		var state = color.RedString("down")
+
+		if service.Up {
+			state = color.GreenString("up")
+		}
+
+		fmt.Printf("\t\t%-14v%-6v%v\n", service.Name, service.Port.Host, state)
+	}
+
+	if s.APIError != nil {
+		fmt.Printf("API\t\t%v (%v)\n", color.RedString("not answering"), s.APIError)
+		return
+	}
+
+	fmt.Printf("API\t\t%v on %v\n", color.GreenString("answering"), config.Global.Endpoint)
+}
+
+func checkStatusDigest(s run.Status) {
+	var pin = getPin()
+	var digest = s.Image.Digest()
+
+	if s.Running && s.Container.Image == pin.Image() &&
+		pin.Digest != "" && pin.Digest != digest {
+		println(run.DigestWarning(pin, digest))
+	}
+}
+
+func snapshotRun(cmd *cobra.Command, args []string) {
+	if err := cmd.Help(); err != nil {
+		panic(err)
+	}
+}
+
+func snapshotSaveRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		println("This command takes 1 argument.")
+		os.Exit(1)
+	}
+
+	var path, err = run.SaveSnapshot(GetDocker(), args[0])
+
+	if err != nil {
+		Exit(err)
+	}
+
+	fmt.Println("Snapshot saved to " + path + ".")
+}
+
+func snapshotRestoreRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		println("This command takes 1 argument.")
+		os.Exit(1)
+	}
+
+	if !yes && !prompt.Confirm(
+		"This replaces all local projects and their data. Continue?") {
+		os.Exit(1)
+	}
+
+	if err := run.RestoreSnapshot(GetDocker(), args[0]); err != nil {
+		Exit(err)
+	}
+
+	fmt.Println("Snapshot " + args[0] + " restored.")
+}
+
+// LocalEndpoint gets the local endpoint for the configured run ports
+func LocalEndpoint() string {
+	var ports, err = run.Ports(config.Global.Run.Ports)
+
+	if err != nil {
+		verbose.Debug("Ignoring run ports configuration:", err)
+	}
+
+	return run.LocalEndpoint(ports)
+}
+
+// setLocalEndpoint makes the endpoint follow the API port remapped by --port
+func setLocalEndpoint(mappings []string) {
+	if os.Getenv("WEDEPLOY_OVERRIDE_LOCAL_ENDPOINT") != "" {
+		return
+	}
+
+	var all, err = run.Ports(mappings)
+
+	if err != nil {
+		return
+	}
+
+	var endpoint = run.LocalEndpoint(all)
+
+	if endpoint != config.Global.Endpoint {
+		println("The API is available on " + endpoint + " for this run only.")
+		println("Set the ports on the [run] section of " + config.Global.Path +
+			" to use it with other commands.")
+	}
+
+	config.Global.Endpoint = endpoint
 }
 
 func init() {
@@ -42,4 +525,52 @@ func init() {
 
 	RunCmd.Flags().BoolVar(&viewMode, "view-mode", false,
 		"View only mode (no controls)")
+
+	RunCmd.Flags().StringSliceVar(&ports, "port", nil,
+		"Remap a port as host:container (such as 8081:80)")
+
+	RunCmd.Flags().BoolVar(&fresh, "fresh", false,
+		"Remove all data and start from a clean state")
+
+	RunCmd.Flags().StringVar(&image, "image", "",
+		"Use the image tag[@digest] for this run only")
+
+	RunCmd.Flags().StringVar(&hostIP, "host-ip", "",
+		"Use this address as the host IP instead of detecting it")
+
+	RunCmd.Flags().StringVar(&memory, "memory", "",
+		"Memory limit (such as 2g)")
+
+	RunCmd.Flags().StringVar(&cpus, "cpus", "",
+		"Number of CPUs (such as 1.5)")
+
+	RunCmd.Flags().StringArrayVarP(&env, "env", "e", nil,
+		"Set an environment variable as NAME=value")
+
+	RunCmd.Flags().StringArrayVar(&volumes, "volume", nil,
+		"Mount a volume as host:container[:ro]")
+
+	RunCmd.Flags().StringVar(&network, "network", "",
+		"Connect to a docker network")
+
+	resetCmd.Flags().BoolVar(&yes, "yes", false,
+		"Remove the data without asking for confirmation")
+
+	snapshotRestoreCmd.Flags().BoolVar(&yes, "yes", false,
+		"Restore without asking for confirmation")
+
+	statusCmd.Flags().BoolVar(&wait, "wait", false,
+		"Wait until the infrastructure is ready")
+
+	statusCmd.Flags().DurationVar(&timeout, "timeout", 2*time.Minute,
+		"Maximum time to wait")
+
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	RunCmd.AddCommand(statusCmd)
+	RunCmd.AddCommand(resetCmd)
+	RunCmd.AddCommand(snapshotCmd)
+	RunCmd.AddCommand(imagesCmd)
+	RunCmd.AddCommand(upgradeCmd)
 }
@@ -0,0 +1,115 @@
+package cmdscale
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/containers"
+)
+
+// ScaleCmd changes the number of instances of a container
+var ScaleCmd = &cobra.Command{
+	Use:   "scale [project] [container] <instances>",
+	Short: "Changes the number of instances of a running container",
+	Run:   scaleRun,
+	Example: `we scale portal email 3
+we scale 3
+we scale portal email 2 --persist`,
+}
+
+var (
+	persist bool
+	noWait  bool
+)
+
+func scaleRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		if err := cmd.Help(); err != nil {
+			panic(err)
+		}
+		os.Exit(1)
+	}
+
+	var n, err = strconv.Atoi(args[len(args)-1])
+
+	if err != nil || n < 1 {
+		println("fatal: the number of instances must be a positive number.")
+		os.Exit(1)
+	}
+
+	args = args[:len(args)-1]
+
+	var project, container string
+
+	if project, container, err = cmdcontext.GetProjectAndContainerID(args); err != nil {
+		println("fatal: not a container")
+		os.Exit(1)
+	}
+
+	if err = containers.Scale(project, container, n); err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Scaling container %v of project %v to %d instances.\n", container, project, n)
+
+	if persist {
+		persistRun(args, n)
+	}
+
+	if noWait {
+		return
+	}
+
+	var instances []containers.Instance
+	var healthy = -1
+
+	instances, err = containers.WaitInstances(cmdcontext.SignalContext(), project, container, n,
+		func(instances []containers.Instance) {
+			if h := containers.CountHealthy(instances); h != healthy {
+				healthy = h
+				fmt.Printf("%d of %d instances healthy.\n", healthy, n)
+			}
+		})
+
+	containers.PrintInstances(os.Stdout, instances, time.Now())
+
+	switch err {
+	case nil:
+	case context.Canceled:
+		println("Stopped waiting. The container is still being scaled.")
+		os.Exit(1)
+	default:
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func persistRun(args []string, n int) {
+	var _, path, err = cmdcontext.GetLocalContainerPath(args)
+	var file string
+
+	if err == nil {
+		file, err = containers.SetInstances(path, n)
+	}
+
+	if err != nil {
+		println("fatal: can't save the number of instances on the container definition: " + err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Saved %d instances on %v.\n", n, file)
+}
+
+func init() {
+	ScaleCmd.Flags().BoolVar(&persist, "persist", false,
+		"Save the number of instances on the local container definition")
+
+	ScaleCmd.Flags().BoolVar(&noWait, "no-wait", false,
+		"Don't wait for the instances to become healthy")
+}
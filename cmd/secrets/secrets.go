@@ -0,0 +1,368 @@
+package cmdsecrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmdcontext"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/containers"
+	"github.com/wedeploy/cli/prompt"
+	"github.com/wedeploy/cli/schema"
+	"github.com/wedeploy/cli/secrets"
+)
+
+// SecretsCmd manages the encrypted environment variables of containers
+var SecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage encrypted environment variables",
+	Long: `Manage encrypted environment variables
+
+Secret values are kept encrypted on the container.json (as enc:...)
+and only decrypted in memory when linking or deploying.
+
+Each project has a key, saved on ~/.we_secrets or given by the
+WEDEPLOY_SECRETS_KEY environment variable. Share it with your
+team with "we secrets export" and "we secrets import".`,
+	Run: secretsRun,
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init [project]",
+	Short: "Creates the secrets key of a project",
+	Run:   initRun,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [project]",
+	Short: "Prints the secrets key of a project, to share with your team",
+	Run:   exportRun,
+}
+
+var importCmd = &cobra.Command{
+	Use:     "import <key> [project]",
+	Short:   "Adds a key shared by your team as the current secrets key",
+	Example: "we secrets import $(cat key.txt)",
+	Run:     importRun,
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set <key>[=<value>] [project] [container]",
+	Short: "Encrypts and sets the environment variable <key>",
+	Long: `Encrypts and sets the environment variable <key>
+
+The value is asked for when not given, keeping it out of the shell history.`,
+	Example: `we secrets set DB_PASSWORD
+we secrets set API_TOKEN=abc123`,
+	Run: setRun,
+}
+
+var encryptCmd = &cobra.Command{
+	Use:     "encrypt <key> [project] [container]",
+	Short:   "Encrypts the plain value of the environment variable <key>",
+	Example: "we secrets encrypt DB_PASSWORD",
+	Run:     encryptRun,
+}
+
+var getCmd = &cobra.Command{
+	Use:     "get <key> [project] [container]",
+	Short:   "Prints the decrypted value of the environment variable <key>",
+	Example: "we secrets get DB_PASSWORD",
+	Run:     getRun,
+}
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate [project]",
+	Short: "Creates a new secrets key and encrypts every secret with it",
+	Run:   rotateRun,
+}
+
+var keepOld bool
+
+func secretsRun(cmd *cobra.Command, args []string) {
+	if err := cmd.Help(); err != nil {
+		panic(err)
+	}
+}
+
+func initRun(cmd *cobra.Command, args []string) {
+	var project = getProjectID(args)
+
+	switch _, err := secrets.Load(project); err {
+	case secrets.ErrNoKey:
+	case nil:
+		fatal(secrets.ErrKeyExists)
+	default:
+		fatal(err)
+	}
+
+	var k, err = secrets.New()
+
+	if err == nil {
+		err = k.Save(project)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("Secrets key saved to %v.\n", secrets.KeyPath(project))
+	fmt.Println(`Share it with your team with "we secrets export".`)
+}
+
+func exportRun(cmd *cobra.Command, args []string) {
+	var k = load(getProjectID(args))
+	fmt.Println(secrets.FormatKey(k.Keys[0]))
+}
+
+func importRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project.")
+		os.Exit(1)
+	}
+
+	var key, err = secrets.ParseKey(args[0])
+
+	if err != nil {
+		fatal(err)
+	}
+
+	var project = getProjectID(args[1:])
+	var k *secrets.Keyring
+
+	switch k, err = secrets.Load(project); err {
+	case secrets.ErrNoKey:
+		k = &secrets.Keyring{}
+	case nil:
+	default:
+		fatal(err)
+	}
+
+	var keys = [][]byte{key}
+
+	for _, old := range k.Keys {
+		if string(old) != string(key) {
+			keys = append(keys, old)
+		}
+	}
+
+	k.Keys = keys
+
+	if err = k.Save(project); err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("Secrets key imported to %v.\n", secrets.KeyPath(project))
+}
+
+func setRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project and container.")
+		os.Exit(1)
+	}
+
+	var kv = strings.SplitN(args[0], "=", 2)
+
+	if !containers.ValidEnvKey(kv[0]) {
+		println("fatal: invalid environment variable name " + kv[0] + ".")
+		os.Exit(1)
+	}
+
+	var project, path, err = cmdcontext.GetLocalContainerPath(args[1:])
+
+	if err != nil {
+		fatal(err)
+	}
+
+	var k = load(project)
+
+	if len(kv) == 1 {
+		kv = append(kv, prompt.Prompt(kv[0]))
+	}
+
+	encrypt(k, path, kv[0], kv[1])
+}
+
+func encryptRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project and container.")
+		os.Exit(1)
+	}
+
+	var key = args[0]
+	var project, path, err = cmdcontext.GetLocalContainerPath(args[1:])
+	var c *containers.Container
+
+	if err == nil {
+		c, err = containers.ReadRaw(path)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	// the plain value on the definition is encrypted, never the resolved one
+	var value, ok = c.Env[key]
+
+	switch {
+	case !ok:
+		println("fatal: " + key + " is not set on the container definition.")
+		os.Exit(1)
+	case secrets.IsEncrypted(value):
+		println(key + " is already encrypted.")
+		return
+	case schema.HasVariables(value):
+		println("fatal: " + key + " is set by a variable. " +
+			"Set its value with \"we secrets set " + key + "\".")
+		os.Exit(1)
+	}
+
+	encrypt(load(project), path, key, value)
+}
+
+func getRun(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		println("This command takes a key and an optional project and container.")
+		os.Exit(1)
+	}
+
+	var key = args[0]
+	var project, _, c, err = cmdcontext.GetLocalContainer(args[1:])
+
+	if err != nil {
+		fatal(err)
+	}
+
+	var value, ok = c.Env[key]
+
+	if !ok {
+		os.Exit(1)
+	}
+
+	if secrets.IsEncrypted(value) {
+		if value, err = load(project).Decrypt(key, value); err != nil {
+			fatal(err)
+		}
+	}
+
+	fmt.Println(value)
+}
+
+func rotateRun(cmd *cobra.Command, args []string) {
+	var project = getProjectID(args)
+	var k = load(project)
+
+	if os.Getenv(secrets.KeyEnv) != "" {
+		println("fatal: can't rotate a key given by " + secrets.KeyEnv + ".")
+		os.Exit(1)
+	}
+
+	var list, err = containers.GetListFromDirectory(config.Context.ProjectRoot)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if err = k.Rotate(); err != nil {
+		fatal(err)
+	}
+
+	// the keyring is saved with the old keys first, so an interruption loses nothing
+	if err = k.Save(project); err != nil {
+		fatal(err)
+	}
+
+	var failed = false
+
+	for _, dir := range list {
+		failed = !rotateContainer(k, filepath.Join(config.Context.ProjectRoot, dir)) || failed
+	}
+
+	// the old keys are only dropped after every file is encrypted with the new key
+	if failed {
+		println("fatal: the old keys were kept, as not every secret was encrypted with the new key.")
+		println(`Fix the errors and run "we secrets rotate" again.`)
+		os.Exit(1)
+	}
+
+	if !keepOld {
+		k.Keys = k.Keys[:1]
+
+		if err = k.Save(project); err != nil {
+			fatal(err)
+		}
+	}
+
+	fmt.Println(`Secrets key rotated. Share the new key with your team with "we secrets export".`)
+}
+
+// rotateContainer encrypts the secrets of a container definition and its overlays
+// with the current key, telling if it succeeded
+func rotateContainer(k *secrets.Keyring, path string) bool {
+	var files, err = containers.ReencryptSecrets(path, k)
+
+	for _, file := range files {
+		fmt.Printf("Secrets of %v encrypted with the new key.\n", file)
+	}
+
+	if err != nil {
+		println("error: " + err.Error())
+		return false
+	}
+
+	return true
+}
+
+func encrypt(k *secrets.Keyring, path, key, value string) {
+	var encrypted, err = k.Encrypt(key, value)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	if err = containers.UpdateEnv(path, map[string]string{key: encrypted}, nil); err != nil {
+		fatal(err)
+	}
+}
+
+func load(project string) *secrets.Keyring {
+	var k, err = secrets.Load(project)
+
+	if err != nil {
+		fatal(err)
+	}
+
+	return k
+}
+
+func getProjectID(args []string) string {
+	var project, err = cmdcontext.GetProjectID(args)
+
+	if err != nil {
+		println("fatal: not a project")
+		os.Exit(1)
+	}
+
+	return project
+}
+
+func fatal(err error) {
+	println("fatal: " + err.Error())
+	os.Exit(1)
+}
+
+func init() {
+	rotateCmd.Flags().BoolVar(&keepOld, "keep-old", false,
+		"Keep the old keys to decrypt values encrypted with them")
+
+	SecretsCmd.AddCommand(initCmd)
+	SecretsCmd.AddCommand(exportCmd)
+	SecretsCmd.AddCommand(importCmd)
+	SecretsCmd.AddCommand(setCmd)
+	SecretsCmd.AddCommand(encryptCmd)
+	SecretsCmd.AddCommand(getCmd)
+	SecretsCmd.AddCommand(rotateCmd)
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/cmd/run"
 	"github.com/wedeploy/cli/run"
 )
 
@@ -21,5 +22,7 @@ func stopRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	run.Stop()
+	if err := run.Stop(cmdrun.GetDocker()); err != nil {
+		cmdrun.Exit(err)
+	}
 }
@@ -1,12 +1,16 @@
 package cmdunlink
 
 import (
+	"fmt"
 	"os"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/wedeploy/cli/cmdcontext"
 	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/projects"
+	"github.com/wedeploy/cli/prompt"
+	"github.com/wedeploy/cli/verbose"
 )
 
 // UnlinkCmd unlinks the given project or container locally
@@ -17,16 +21,38 @@ var UnlinkCmd = &cobra.Command{
 	Example: `we unlink
 we unlink <project>
 we unlink <project> <container>
-we unlink <container>`,
+we unlink <container>
+we unlink --all-containers
+we unlink --yes`,
 }
 
+var (
+	yes           bool
+	allContainers bool
+)
+
 func unlinkRun(cmd *cobra.Command, args []string) {
 	var project, container, err = cmdcontext.GetProjectOrContainerID(args)
 
-	switch {
-	case err != nil:
+	if err != nil {
 		println("fatal: not a project")
 		os.Exit(1)
+	}
+
+	if allContainers && container != "" {
+		println("fatal: --all-containers can't be used with a container")
+		os.Exit(1)
+	}
+
+	printUnlinkPlan(project, container)
+
+	if !yes && !prompt.Confirm("Continue?") {
+		os.Exit(1)
+	}
+
+	switch {
+	case allContainers:
+		err = unlinkAllContainers(project)
 	case container == "":
 		err = projects.Unlink(project)
 	default:
@@ -38,3 +64,65 @@ func unlinkRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 }
+
+func printUnlinkPlan(project, container string) {
+	if container != "" {
+		fmt.Printf("Container %v of project %v will be unlinked.\n", container, project)
+		return
+	}
+
+	if allContainers {
+		fmt.Printf("The containers of project %v will be unlinked, keeping the project", project)
+	} else {
+		fmt.Printf("Project %v will be unlinked", project)
+	}
+
+	var cs, err = containers.GetList(project)
+
+	if err != nil {
+		verbose.Debug("Can't list the containers of project", project+":", err)
+		fmt.Println(".")
+		return
+	}
+
+	if len(cs) == 0 {
+		fmt.Println(". It has no containers.")
+		return
+	}
+
+	if allContainers {
+		fmt.Println(":")
+	} else {
+		fmt.Println(" with its containers:")
+	}
+
+	var ids = []string{}
+
+	for id := range cs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		fmt.Printf("  - %v\n", id)
+	}
+}
+
+func unlinkAllContainers(project string) error {
+	var unlinked, err = containers.UnlinkAll(project)
+
+	for _, id := range unlinked {
+		fmt.Printf("Container %v unlinked.\n", id)
+	}
+
+	return err
+}
+
+func init() {
+	UnlinkCmd.Flags().BoolVar(&yes, "yes", false,
+		"Unlink without asking for confirmation")
+
+	UnlinkCmd.Flags().BoolVar(&allContainers, "all-containers", false,
+		"Unlink every container of the project, keeping the project")
+}
@@ -0,0 +1,54 @@
+package cmdvalidate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/schema"
+)
+
+// ValidateCmd validates the project and container definitions
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the project definition and the definition of every container",
+	Run:   validateRun,
+	Example: `we validate
+we validate --strict`,
+}
+
+var strict bool
+
+func validateRun(cmd *cobra.Command, args []string) {
+	if config.Context.ProjectRoot == "" {
+		println("fatal: not inside a project")
+		os.Exit(1)
+	}
+
+	var problems, err = schema.ValidateProject(config.Context.ProjectRoot)
+
+	if err != nil {
+		println("fatal: " + err.Error())
+		os.Exit(1)
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+
+	var errors = len(schema.Errors(problems))
+	var warnings = len(problems) - errors
+
+	if errors != 0 || (strict && warnings != 0) {
+		fmt.Fprintf(os.Stderr, "%d errors, %d warnings.\n", errors, warnings)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Definitions are valid (schema %v, %d warnings).\n", schema.Version, warnings)
+}
+
+func init() {
+	ValidateCmd.Flags().BoolVar(&strict, "strict", false,
+		"Fail on warnings, such as unknown keys")
+}
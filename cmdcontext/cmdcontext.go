@@ -1,11 +1,16 @@
 package cmdcontext
 
 import (
+	"context"
 	"errors"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/wedeploy/cli/config"
 	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/projects"
+	"github.com/wedeploy/cli/verbose"
 )
 
 var (
@@ -14,8 +19,20 @@ var (
 
 	// ErrInvalidArgumentLength error message
 	ErrInvalidArgumentLength = errors.New("Unexpected arguments length")
+
+	// ErrNotContainer is used when a local definition is needed outside of a container
+	ErrNotContainer = errors.New("not a container")
 )
 
+// NotCurrentProjectError is used when a local definition is needed for another project
+type NotCurrentProjectError struct {
+	ProjectID string
+}
+
+func (n NotCurrentProjectError) Error() string {
+	return n.ProjectID + " is not the current project"
+}
+
 // GetProjectID gets the project ID
 func GetProjectID(args []string) (projectID string, err error) {
 	switch len(args) {
@@ -54,6 +71,54 @@ func GetProjectOrContainerID(args []string) (projectID, containerID string, err
 	}
 }
 
+// GetLocalContainer gets the project ID, the container directory
+// and the local definition of the container on the arguments or context,
+// resolved for the current environment
+func GetLocalContainer(args []string) (projectID, path string, c *containers.Container, err error) {
+	if projectID, path, err = GetLocalContainerPath(args); err == nil {
+		c, err = containers.Read(path)
+	}
+
+	return projectID, path, c, err
+}
+
+// GetLocalContainerPath gets the project ID and the container directory
+// of the local definition of the container on the arguments or context
+func GetLocalContainerPath(args []string) (projectID, path string, err error) {
+	var containerID string
+
+	if projectID, containerID, err = GetProjectAndContainerID(args); err != nil {
+		return "", "", ErrNotContainer
+	}
+
+	if local, lerr := getCtxProjectID(); lerr != nil || local != projectID {
+		return projectID, "", NotCurrentProjectError{projectID}
+	}
+
+	if len(args) == 0 {
+		return projectID, config.Context.ContainerRoot, nil
+	}
+
+	path, err = containers.FindPath(config.Context.ProjectRoot, containerID)
+	return projectID, path, err
+}
+
+// SignalContext gets a context canceled by Ctrl+C (or SIGTERM)
+func SignalContext() context.Context {
+	var ctx, cancel = context.WithCancel(context.Background())
+	var sigs = make(chan os.Signal, 1)
+
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		verbose.Debug("Stop signal received.")
+		cancel()
+	}()
+
+	return ctx
+}
+
 // SplitArguments splits a group of arguments (e.g., project + container)
 func SplitArguments(recArgs []string, offset, limit int) []string {
 	if len(recArgs) < limit {
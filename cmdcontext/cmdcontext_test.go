@@ -311,6 +311,31 @@ func TestGetProjectOrContainerIDWithProjectOrContainerStore(t *testing.T) {
 	config.Teardown()
 }
 
+func TestGetLocalContainer(t *testing.T) {
+	var workingDir, _ = os.Getwd()
+	chdir("./mocks/project/container")
+	config.Setup()
+
+	var project, path, c, err = GetLocalContainer([]string{"extraction", "mycontainer"})
+
+	if err != nil || project != "extraction" || c.ID != "mycontainer" ||
+		path != config.Context.ContainerRoot {
+		t.Errorf("Unexpected container %v on %v of project %v (error: %v)", c, path, project, err)
+	}
+
+	if _, _, _, err = GetLocalContainer([]string{"x6432", "y535"}); err != (NotCurrentProjectError{"x6432"}) ||
+		err.Error() != "x6432 is not the current project" {
+		t.Errorf("Expected not current project error, got %v instead", err)
+	}
+
+	if _, _, _, err = GetLocalContainer([]string{"x"}); err != ErrNotContainer {
+		t.Errorf("Wanted error %v, got %v instead", ErrNotContainer, err)
+	}
+
+	chdir(workingDir)
+	config.Teardown()
+}
+
 func TestSplitArguments(t *testing.T) {
 	for _, c := range SplitArgumentsCases {
 		var args = SplitArguments(c.ReceivedArgs, c.Offset, c.Limit)
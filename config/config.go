@@ -3,8 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"sync"
 
 	"gopkg.in/ini.v1"
 
@@ -65,25 +67,63 @@ func (r *Remotes) Del(name string) {
 
 // Config of the application
 type Config struct {
-	Username        string    `ini:"username"`
-	Password        string    `ini:"password"`
-	Token           string    `ini:"token"`
-	Local           bool      `ini:"local"`
-	NoColor         bool      `ini:"disable_colors"`
-	Endpoint        string    `ini:"endpoint"`
-	NotifyUpdates   bool      `ini:"notify_updates"`
-	ReleaseChannel  string    `ini:"release_channel"`
-	LastUpdateCheck string    `ini:"last_update_check"`
-	NextVersion     string    `ini:"next_version"`
-	Path            string    `ini:"-"`
-	Remotes         Remotes   `ini:"-"`
-	file            *ini.File `ini:"-"`
+	Username        string     `ini:"username"`
+	Password        string     `ini:"password"`
+	Token           string     `ini:"token"`
+	Local           bool       `ini:"local"`
+	NoColor         bool       `ini:"disable_colors"`
+	Endpoint        string     `ini:"endpoint"`
+	NotifyUpdates   bool       `ini:"notify_updates"`
+	ReleaseChannel  string     `ini:"release_channel"`
+	LastUpdateCheck string     `ini:"last_update_check"`
+	NextVersion     string     `ini:"next_version"`
+	Remote          string     `ini:"remote"`
+	LogLevel        string     `ini:"log_level"`
+	DeployIgnore    []string   `ini:"deploy_ignore"`
+	Hooks           []string   `ini:"hooks"`
+	Path            string     `ini:"-"`
+	Remotes         Remotes    `ini:"-"`
+	Run             RunConfig  `ini:"-"`
+	file            *ini.File  `ini:"-"`
+	partial         bool       `ini:"-"`
+	overrides       []Override `ini:"-"`
+	baseline        entries    `ini:"-"`
+	baselinePath    string     `ini:"-"`
+	saveMutex       sync.Mutex `ini:"-"`
+	loadErr         error      `ini:"-"`
+	migratedFrom    int        `ini:"-"`
+	migrating       bool       `ini:"-"`
 }
 
+// RunConfig for the local infrastructure (the [run] section)
+type RunConfig struct {
+	Ports   []string `ini:"ports"`
+	Image   string   `ini:"image"`
+	HostIP  string   `ini:"host_ip"`
+	Memory  string   `ini:"memory"`
+	CPUs    string   `ini:"cpus"`
+	Env     []string `ini:"env"`
+	Volumes []string `ini:"volumes"`
+	Network string   `ini:"network"`
+}
+
+// Override of a global configuration key by the project configuration
+type Override struct {
+	Key     string
+	Global  string
+	Project string
+}
+
+// ProjectConfigFile is the name of the configuration file of a project
+const ProjectConfigFile = "wedeploy.ini"
+
 var (
-	// Global configuration
+	// Global configuration (merged with the project configuration, if any)
 	Global *Config
 
+	// Project configuration
+	Project *Config
+
 	// Context stores the environmental context
 	Context *context.Context
 )
@@ -95,29 +135,94 @@ func (c *Config) Load() {
 		c.read()
 	default:
 		verbose.Debug("Config file not found.")
-		c.file = ini.Empty()
-		c.banner()
+		c.create()
 	}
 
 	c.load()
+
+	if !c.partial {
+		c.reflect()
+	}
+
+	c.setBaseline()
+}
+
+// LoadError returns the error found reading the configuration file, if any
+// A configuration that failed to load uses the default values and is never saved.
+func (c *Config) LoadError() error {
+	return c.loadErr
 }
 
-// Save the configuration
-func (c *Config) Save() {
-	var cfg = c.file
-	var err = cfg.ReflectFrom(c)
+// NewProjectConfig creates the configuration for the project at root
+// Only the keys explicitly set are stored on a project configuration file
+func NewProjectConfig(root string) *Config {
+	var path, err = context.FindProjectConfig(root)
 
 	if err != nil {
 		panic(err)
 	}
 
+	if path == "" {
+		path = filepath.Join(root, ProjectConfigFile)
+	}
+
+	return &Config{
+		Path:    path,
+		partial: true,
+	}
+}
+
+func (c *Config) reflect() {
+	if err := c.file.ReflectFrom(c); err != nil {
+		panic(err)
+	}
+
 	c.updateRemotes()
+	c.updateRun()
+	c.restoreOverrides()
 	c.simplify()
+}
 
-	err = cfg.SaveTo(c.Path)
+// merge the project configuration over the global configuration
+// Keys that only the global configuration may set are ignored.
+func (c *Config) merge(project *Config) {
+	for _, key := range Keys() {
+		var value, err = project.Get(key.Name)
 
-	if err != nil {
-		panic(err)
+		if err != nil {
+			continue
+		}
+
+		if key.Global {
+			verbose.Debug("Ignoring " + key.Name + " on the project configuration " + project.Path)
+			continue
+		}
+
+		var field = c.field(key)
+
+		c.overrides = append(c.overrides, Override{
+			Key:     key.Name,
+			Global:  formatValue(field),
+			Project: value,
+		})
+
+		if err = setField(field, key, value); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// restoreOverrides keeps the values overridden by the project
+// from leaking into the global configuration file
+func (c *Config) restoreOverrides() {
+	var section = c.file.Section("")
+
+	for _, o := range c.overrides {
+		var key, _ = GetKey(o.Key)
+
+		if formatValue(c.field(key)) == o.Project {
+			section.Key(o.Key).SetValue(o.Global)
+		}
 	}
 }
 
@@ -125,6 +230,12 @@ func (c *Config) Save() {
 func Setup() {
 	setupContext()
 	setupGlobal()
+	setupProject()
+}
+
+// Overrides returns the list of keys overridden by the project configuration
+func (c *Config) Overrides() []Override {
+	return c.overrides
 }
 
 func (c *Config) setDefaults() {
@@ -153,27 +264,75 @@ func (c *Config) load() {
 	if err := c.file.MapTo(c); err != nil {
 		panic(err)
 	}
+
+	if section, err := c.file.GetSection("run"); err == nil {
+		if err = section.MapTo(&c.Run); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (c *Config) create() {
+	c.file = ini.Empty()
+	c.banner()
+
+	if !c.partial {
+		setVersion(c.file)
+	}
+
+	c.readRemotes()
 }
 
 func (c *Config) read() {
-	var err error
-	c.file, err = ini.Load(c.Path)
+	var f, err = ini.Load(c.Path)
 
 	if err != nil {
-		println("Error reading configuration file:", err.Error())
-		println("Fix " + c.Path + " by hand or erase it.")
-		os.Exit(1)
+		c.loadErr = err
+		c.file = ini.Empty()
+		c.readRemotes()
+		return
+	}
+
+	c.file = f
+
+	// project configuration files are not versioned
+	if !c.partial {
+		c.upgrade()
 	}
 
 	c.readRemotes()
 }
 
+// upgrade the configuration file in memory; it is only rewritten on Save
+func (c *Config) upgrade() {
+	var version, err = FileVersion(c.file)
+
+	switch {
+	case err != nil:
+		c.loadErr = err
+	case version < Version:
+		c.migratedFrom = version
+		c.migrating = true
+		migrate(c.file, version)
+	}
+}
+
 func (c *Config) readRemotes() {
-	var remotes = c.file.Section("remotes")
 	c.Remotes = Remotes{
 		list: remotesList{},
 	}
 
+	// a project can only pick one of the global remotes, by name
+	if c.partial {
+		return
+	}
+
+	var remotes, err = c.file.GetSection("remotes")
+
+	if err != nil {
+		return
+	}
+
 	for _, k := range remotes.KeyStrings() {
 		key := remotes.Key(k)
 		comment := strings.TrimPrefix(key.Comment, "#")
@@ -187,7 +346,14 @@ func (c *Config) readRemotes() {
 
 func (c *Config) simplify() {
 	var mainSection = c.file.Section("")
-	var omitempty = []string{"next_version", "last_update_check"}
+	var omitempty = []string{
+		"next_version",
+		"last_update_check",
+		"remote",
+		"log_level",
+		"deploy_ignore",
+		"hooks",
+	}
 
 	for _, k := range omitempty {
 		var key = mainSection.Key(k)
@@ -231,7 +397,41 @@ func (c *Config) updateRemotes() {
 	c.simplifyRemotes()
 }
 
+func (c *Config) updateRun() {
+	var run = c.file.Section("run")
+
+	if err := run.ReflectFrom(&c.Run); err != nil {
+		panic(err)
+	}
+
+	// ReflectFrom skips empty lists, so they are set explicitly
+	var v = reflect.ValueOf(c.Run)
+
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() == reflect.Slice {
+			var name = v.Type().Field(i).Tag.Get("ini")
+			run.Key(name).SetValue(formatValue(v.Field(i)))
+		}
+	}
+
+	for _, key := range run.Keys() {
+		if key.Value() == "" && key.Comment == "" {
+			run.DeleteKey(key.Name())
+		}
+	}
+
+	if len(run.Keys()) == 0 && run.Comment == "" {
+		c.file.DeleteSection("run")
+	}
+}
+
 func (c *Config) banner() {
+	if c.partial {
+		c.file.Section("DEFAULT").Comment = `# Project configuration file for WeDeploy CLI
+# https://wedeploy.io`
+		return
+	}
+
 	c.file.Section("DEFAULT").Comment = `# Configuration file for WeDeploy CLI
 # https://wedeploy.io`
 }
@@ -254,6 +454,18 @@ func setupGlobal() {
 	Global.Load()
 }
 
+func setupProject() {
+	var path = Context.ProjectConfig
+
+	if path == "" || path == Global.Path {
+		return
+	}
+
+	Project = NewProjectConfig(Context.ProjectRoot)
+	Project.Load()
+	Global.merge(Project)
+}
+
 // Teardown resets the configuration environment
 func Teardown() {
 	teardownContext()
@@ -266,4 +478,5 @@ func teardownContext() {
 
 func teardownGlobal() {
 	Global = nil
+	Project = nil
 }
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/wedeploy/cli/tdata"
@@ -172,6 +175,11 @@ func TestSave(t *testing.T) {
 		panic(err)
 	}
 
+	// Save locks the configuration with a file next to it
+	if err = os.Remove(tmp.Name() + ".lock"); err != nil {
+		panic(err)
+	}
+
 	unsetenv("WEDEPLOY_CUSTOM_HOME")
 	Teardown()
 }
@@ -207,6 +215,10 @@ func TestSaveAfterCreation(t *testing.T) {
 		panic(err)
 	}
 
+	if err = os.Remove(tmp.Name() + ".lock"); err != nil {
+		panic(err)
+	}
+
 	unsetenv("WEDEPLOY_CUSTOM_HOME")
 	Teardown()
 }
@@ -255,6 +267,10 @@ func TestRemotes(t *testing.T) {
 		panic(err)
 	}
 
+	if err = os.Remove(tmp.Name() + ".lock"); err != nil {
+		panic(err)
+	}
+
 	if Global.Username != "fool" {
 		t.Errorf("Wrong username")
 	}
@@ -346,6 +362,170 @@ func TestRemotesListAndGet(t *testing.T) {
 	}
 }
 
+const helperSaves = 10
+
+func TestSaveConcurrentProcesses(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var processes = 8
+	var cmds = []*exec.Cmd{}
+
+	for i := 0; i < processes; i++ {
+		var cmd = exec.Command(os.Args[0], "-test.run=TestHelperProcessSave")
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("WEDEPLOY_CONFIG_HELPER_PROCESS=%d", i),
+			"WEDEPLOY_CUSTOM_HOME="+home)
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Start(); err != nil {
+			panic(err)
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("Helper process failure: %v", err)
+		}
+	}
+
+	var c = &Config{
+		Path: filepath.Join(home, ".we"),
+	}
+
+	c.Load()
+
+	if len(c.Remotes.List()) != processes*helperSaves {
+		t.Errorf("Expected %d remotes, got %v instead",
+			processes*helperSaves, c.Remotes.List())
+	}
+
+	assertNoTemporaryFiles(t, home)
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestHelperProcessSave(t *testing.T) {
+	var id = os.Getenv("WEDEPLOY_CONFIG_HELPER_PROCESS")
+
+	if id == "" {
+		return
+	}
+
+	Setup()
+
+	for j := 0; j < helperSaves; j++ {
+		Global.Remotes.Set(fmt.Sprintf("process%v-%d", id, j), "http://example.com/")
+		Global.Save()
+	}
+
+	Teardown()
+}
+
+func TestSaveConcurrentGoroutines(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var routines = 8
+	var wg sync.WaitGroup
+
+	wg.Add(routines)
+
+	for i := 0; i < routines; i++ {
+		go func(i int) {
+			var c = &Config{
+				Path: path,
+			}
+
+			c.Load()
+
+			for j := 0; j < helperSaves; j++ {
+				c.Remotes.Set(fmt.Sprintf("routine%d-%d", i, j), "http://example.com/")
+				c.Save()
+			}
+
+			wg.Done()
+		}(i)
+	}
+
+	wg.Wait()
+
+	var c = &Config{
+		Path: path,
+	}
+
+	c.Load()
+
+	if len(c.Remotes.List()) != routines*helperSaves {
+		t.Errorf("Expected %d remotes, got %v instead",
+			routines*helperSaves, c.Remotes.List())
+	}
+
+	assertNoTemporaryFiles(t, home)
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestSaveKeepsExternalChanges(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var first = &Config{Path: path}
+	var second = &Config{Path: path}
+
+	first.Load()
+	second.Load()
+
+	first.Username = "first"
+	first.Save()
+
+	second.ReleaseChannel = "unstable"
+	second.Save()
+
+	var c = &Config{Path: path}
+	c.Load()
+
+	if c.Username != "first" || c.ReleaseChannel != "unstable" {
+		t.Errorf("Expected changes from both saves, got username %v and channel %v",
+			c.Username, c.ReleaseChannel)
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func assertNoTemporaryFiles(t *testing.T, dir string) {
+	var files, err = ioutil.ReadDir(dir)
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, f := range files {
+		if f.Name() != ".we" && f.Name() != ".we.lock" {
+			t.Errorf("Unexpected file %v left on %v", f.Name(), dir)
+		}
+	}
+}
+
 func abs(path string) string {
 	var abs, err = filepath.Abs(path)
 
@@ -371,3 +551,520 @@ func unsetenv(key string) {
 		panic(err)
 	}
 }
+
+func TestKeys(t *testing.T) {
+	var want = []string{
+		"username",
+		"password",
+		"token",
+		"local",
+		"disable_colors",
+		"endpoint",
+		"notify_updates",
+		"release_channel",
+		"last_update_check",
+		"next_version",
+		"remote",
+		"log_level",
+		"deploy_ignore",
+		"hooks",
+	}
+
+	var got = []string{}
+
+	for _, k := range Keys() {
+		got = append(got, k.Name)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Wanted keys %v, got %v instead", want, got)
+	}
+
+	if k, _ := GetKey("password"); !k.Secret {
+		t.Errorf("Expected password to be a secret key")
+	}
+
+	if _, err := GetKey("foo"); err != ErrUnknownKey {
+		t.Errorf("Expected unknown key error, got %v instead", err)
+	}
+}
+
+func TestGetAndSetKeys(t *testing.T) {
+	setenv("WEDEPLOY_CUSTOM_HOME", abs("./mocks/home"))
+	Setup()
+
+	if value, err := Global.Get("username"); value != "admin" || err != nil {
+		t.Errorf("Wanted username admin, got %v (error: %v) instead", value, err)
+	}
+
+	if err := Global.Set("notify_updates", "false"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if Global.NotifyUpdates {
+		t.Errorf("Expected NotifyUpdates to be false")
+	}
+
+	var err = Global.Set("disable_colors", "maybe")
+
+	if _, ok := err.(InvalidValueError); !ok {
+		t.Errorf("Expected invalid value error, got %v instead", err)
+	}
+
+	if err := Global.Set("foo", "bar"); err != ErrUnknownKey {
+		t.Errorf("Expected unknown key error, got %v instead", err)
+	}
+
+	if err := Global.Unset("notify_updates"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if !Global.NotifyUpdates {
+		t.Errorf("Expected NotifyUpdates to be restored to true")
+	}
+
+	unsetenv("WEDEPLOY_CUSTOM_HOME")
+	Teardown()
+}
+
+func TestProjectConfig(t *testing.T) {
+	var dir, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var c = NewProjectConfig(dir)
+	c.Load()
+
+	if _, err := c.Get("endpoint"); err != ErrKeyNotSet {
+		t.Errorf("Expected key not set error, got %v instead", err)
+	}
+
+	if err := c.Set("password", "safe"); err != ErrSecretOnProject {
+		t.Errorf("Expected secret on project error, got %v instead", err)
+	}
+
+	if err := c.Set("endpoint", "http://www.example.com/"); err != ErrGlobalOnProject {
+		t.Errorf("Expected global key on project error, got %v instead", err)
+	}
+
+	if err := c.Set("remote", "staging"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := c.Set("release_channel", "unstable"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := c.Unset("release_channel"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	c.Save()
+
+	var got = tdata.FromFile(filepath.Join(dir, ProjectConfigFile))
+	var want = tdata.FromFile("./mocks/we-reference-project.ini")
+
+	if got != want {
+		t.Errorf("Wanted created configuration to match we-reference-project.ini")
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		panic(err)
+	}
+}
+
+func TestSetupProjectConfig(t *testing.T) {
+	setenv("WEDEPLOY_CUSTOM_HOME", abs("./mocks/home"))
+	var workingDir, _ = os.Getwd()
+
+	if err := os.Chdir(filepath.Join(workingDir, "mocks/configured-project")); err != nil {
+		t.Error(err)
+	}
+
+	Setup()
+
+	if Context.ProjectConfig != filepath.Join(workingDir, "mocks/configured-project/wedeploy.ini") {
+		t.Errorf("Context.ProjectConfig doesn't match with expected value")
+	}
+
+	if Project == nil {
+		t.Errorf("Expected config.Project to be set")
+	}
+
+	// the credentials are sent to the endpoint, so a project can't change it
+	if Global.Endpoint != "http://www.example.com/" {
+		t.Errorf("Expected endpoint to not be overridden by the project, got %v instead", Global.Endpoint)
+	}
+
+	if Global.LogLevel != "debug" {
+		t.Errorf("Expected log level to be set by the project, got %v instead", Global.LogLevel)
+	}
+
+	if !reflect.DeepEqual(Global.DeployIgnore, []string{"*.log", "tmp"}) {
+		t.Errorf("Unexpected deploy ignore list %v", Global.DeployIgnore)
+	}
+
+	var wantOverride = Override{
+		Key:     "log_level",
+		Global:  "",
+		Project: "debug",
+	}
+
+	if o := Global.Overrides(); len(o) != 2 || o[0] != wantOverride {
+		t.Errorf("Unexpected overrides %v", o)
+	}
+
+	var tmp, err = ioutil.TempFile(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	// save in a different location
+	Global.Path = tmp.Name()
+
+	Global.Username = "other"
+	Global.Save()
+
+	var got = tdata.FromFile(Global.Path)
+	var want = tdata.FromFile(filepath.Join(workingDir, "mocks/we-reference.ini"))
+
+	if got != want {
+		t.Errorf("Wanted project configuration to not leak into the global configuration")
+	}
+
+	if err = tmp.Close(); err != nil {
+		panic(err)
+	}
+
+	if err = os.Remove(tmp.Name()); err != nil {
+		panic(err)
+	}
+
+	if err = os.Remove(tmp.Name() + ".lock"); err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(workingDir); err != nil {
+		panic(err)
+	}
+
+	unsetenv("WEDEPLOY_CUSTOM_HOME")
+	Teardown()
+}
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var original = tdata.FromFile("./mocks/legacy/.we")
+
+	if err = ioutil.WriteFile(path, []byte(original), 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &Config{Path: path}
+	c.Load()
+
+	if c.LoadError() != nil {
+		t.Errorf("Expected no load error, got %v instead", c.LoadError())
+	}
+
+	if !c.NoColor || c.NotifyUpdates {
+		t.Errorf("Expected legacy keys to be migrated, got disable_colors = %v and notify_updates = %v",
+			c.NoColor, c.NotifyUpdates)
+	}
+
+	c.Save()
+
+	if got := tdata.FromFile(path + ".v0.bak"); got != original {
+		t.Errorf("Expected backup to match the original file, got %v instead", got)
+	}
+
+	var saved = &Config{Path: path}
+	saved.Load()
+
+	if version, _ := FileVersion(saved.file); version != Version {
+		t.Errorf("Expected saved file to be version %v, got %v instead", Version, version)
+	}
+
+	if saved.file.Section("").HasKey("no_color") || saved.file.Section("").HasKey("auto_update") {
+		t.Errorf("Expected legacy keys to be removed")
+	}
+
+	if !saved.NoColor || saved.NotifyUpdates {
+		t.Errorf("Expected migrated values to be saved")
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestBrokenConfig(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var original = tdata.FromFile("./mocks/doctor/broken.ini")
+
+	if err = ioutil.WriteFile(path, []byte(original), 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &Config{Path: path}
+	c.Load()
+
+	if c.LoadError() == nil {
+		t.Errorf("Expected load error")
+	}
+
+	if c.Username != "" || !c.Local || c.ReleaseChannel != "stable" {
+		t.Errorf("Expected default values on broken configuration")
+	}
+
+	c.Username = "other"
+	c.Save()
+
+	if got := tdata.FromFile(path); got != original {
+		t.Errorf("Expected broken configuration file to be kept untouched, got %v instead", got)
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestDiagnoseAndRepair(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var original = tdata.FromFile("./mocks/doctor/broken.ini")
+
+	if err = ioutil.WriteFile(path, []byte(original), 0600); err != nil {
+		panic(err)
+	}
+
+	var problems []Problem
+
+	if problems, err = Diagnose(path, false); err != nil {
+		panic(err)
+	}
+
+	var want = []string{
+		`line 4: invalid line "{ garbage"`,
+		`line 5: Invalid value "maybe" for local: expected bool`,
+		`line 6: unknown key "color"`,
+		`line 10: remote staging has an invalid URL "not a url"`,
+		`line 12: unknown section "extra"`,
+		`configuration file version 0 is older than 1`,
+	}
+
+	var got = []string{}
+	var repairable = []Problem{}
+
+	for _, p := range problems {
+		got = append(got, p.String())
+
+		if p.Repairable() {
+			repairable = append(repairable, p)
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted problems %v, got %v instead", want, got)
+	}
+
+	var backup string
+
+	if backup, err = Repair(path, repairable); err != nil {
+		panic(err)
+	}
+
+	if got := tdata.FromFile(backup); got != original {
+		t.Errorf("Expected backup to match the original file, got %v instead", got)
+	}
+
+	var wantRepaired = tdata.FromFile("./mocks/doctor/we-reference-repaired.ini")
+
+	if got := tdata.FromFile(path); got != wantRepaired {
+		t.Errorf("Wanted repaired file to match we-reference-repaired.ini, got %v instead", got)
+	}
+
+	if problems, err = Diagnose(path, false); err != nil {
+		panic(err)
+	}
+
+	for _, p := range problems {
+		if p.Repairable() {
+			t.Errorf("Unexpected problem left after repair: %v", p)
+		}
+	}
+
+	var c = &Config{Path: path}
+	c.Load()
+
+	if c.LoadError() != nil || c.Username != "admin" || !c.Local {
+		t.Errorf("Expected repaired configuration to load")
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestDiagnoseProjectConfig(t *testing.T) {
+	var problems, err = Diagnose("./mocks/configured-project/wedeploy.ini", true)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// the endpoint of the configured project is ignored and reported
+	if len(problems) != 1 || problems[0].Line != 1 || !problems[0].Repairable() {
+		t.Errorf("Expected endpoint to be reported on project configuration, got %v instead", problems)
+	}
+}
+
+func TestNewerConfigVersion(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var content = fmt.Sprintf("config_version = %d\nusername = admin\n", Version+1)
+
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &Config{Path: path}
+	c.Load()
+	c.Save()
+
+	var saved = &Config{Path: path}
+	saved.Load()
+
+	if version, _ := FileVersion(saved.file); version != Version+1 {
+		t.Errorf("Expected newer version to be kept, got %v instead", version)
+	}
+
+	var problems []Problem
+
+	if problems, err = Diagnose(path, false); err != nil {
+		panic(err)
+	}
+
+	if len(problems) != 1 || problems[0].Repairable() {
+		t.Errorf("Expected newer version to be reported, got %v instead", problems)
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, ".we")
+	var content = "config_version = 1\n\n[run]\n# remapped ports\nports = 8081:80, 9080:8080\n"
+
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &Config{Path: path}
+	c.Load()
+
+	var want = []string{"8081:80", "9080:8080"}
+
+	if !reflect.DeepEqual(c.Run.Ports, want) {
+		t.Errorf("Wanted run ports %v, got %v instead", want, c.Run.Ports)
+	}
+
+	c.Run.Ports = append(c.Run.Ports, "9201:9200")
+	c.Save()
+
+	var saved = &Config{Path: path}
+	saved.Load()
+
+	want = append(want, "9201:9200")
+
+	if !reflect.DeepEqual(saved.Run.Ports, want) {
+		t.Errorf("Wanted saved run ports %v, got %v instead", want, saved.Run.Ports)
+	}
+
+	if comment := saved.file.Section("run").Key("ports").Comment; comment != "# remapped ports" {
+		t.Errorf("Expected comment to be kept, got %q instead", comment)
+	}
+
+	saved.Run.Ports = nil
+	saved.Save()
+
+	var cleared = &Config{Path: path}
+	cleared.Load()
+
+	if len(cleared.Run.Ports) != 0 {
+		t.Errorf("Expected run ports to be cleared, got %v instead", cleared.Run.Ports)
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestDiagnoseProjectRunSection(t *testing.T) {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var path = filepath.Join(home, "wedeploy.ini")
+	var content = "[run]\nimage = 1.0\nports = 8081:80\n"
+
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &Config{Path: path, partial: true}
+	c.Load()
+
+	if c.Run.Image != "1.0" {
+		t.Errorf("Expected project image to be loaded, got %q instead", c.Run.Image)
+	}
+
+	var problems []Problem
+
+	if problems, err = Diagnose(path, true); err != nil {
+		panic(err)
+	}
+
+	if len(problems) != 1 || problems[0].Line != 3 || !problems[0].Repairable() {
+		t.Errorf("Expected only the ports key to be reported, got %v instead", problems)
+	}
+
+	if err = os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,379 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Problem found on a configuration file
+type Problem struct {
+	Line        int
+	Description string
+	Repair      string
+	fix         func(lines []string) []string
+	migrate     bool
+}
+
+// Repairable tells if the problem can be fixed by Repair
+func (p Problem) Repairable() bool {
+	return p.fix != nil || p.migrate
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Description
+	}
+
+	return fmt.Sprintf("line %d: %s", p.Line, p.Description)
+}
+
+// globalSections are the sections of the global configuration file
+var globalSections = map[string]bool{
+	"remotes": true,
+	"run":     true,
+}
+
+// projectSections are the sections of the project configuration file
+var projectSections = map[string]bool{
+	"run": true,
+}
+
+// projectRunKeys are the keys of the [run] section a project may set
+var projectRunKeys = map[string]bool{
+	"image": true,
+}
+
+type diagnosis struct {
+	project    bool
+	problems   []Problem
+	hasVersion bool
+}
+
+// Diagnose validates a configuration file, returning the problems found
+// Project configuration files are validated against the keys they may store.
+func Diagnose(path string, project bool) ([]Problem, error) {
+	var content, err = ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var d = &diagnosis{
+		project: project,
+	}
+
+	d.scan(splitLines(content))
+
+	if !project && !d.hasVersion {
+		d.checkVersion(0, "0")
+	}
+
+	return d.problems, nil
+}
+
+// Repair the given problems of a configuration file
+// The original file is kept on path + ".bak".
+func Repair(path string, problems []Problem) (backupFile string, err error) {
+	var lock *os.File
+
+	if lock, err = acquireLock(path + ".lock"); err != nil {
+		return "", err
+	}
+
+	defer releaseLock(lock)
+
+	var content []byte
+
+	if content, err = ioutil.ReadFile(path); err != nil {
+		return "", err
+	}
+
+	var lines = splitLines(content)
+	var migrating bool
+
+	for _, p := range problems {
+		if p.fix != nil {
+			lines = p.fix(lines)
+		}
+
+		migrating = migrating || p.migrate
+	}
+
+	var repaired = []byte(strings.Join(lines, "\n"))
+
+	if migrating {
+		if repaired, err = migrateContent(repaired); err != nil {
+			return "", err
+		}
+	}
+
+	backupFile = path + ".bak"
+
+	if err = ioutil.WriteFile(backupFile, content, 0600); err != nil {
+		return "", err
+	}
+
+	return backupFile, writeFileAtomic(path, bytes.NewReader(repaired))
+}
+
+func migrateContent(content []byte) ([]byte, error) {
+	var f, err = ini.Load(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var version int
+
+	if version, err = FileVersion(f); err != nil {
+		version = 0
+	}
+
+	migrate(f, version)
+
+	var buf bytes.Buffer
+
+	if _, err = f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func splitLines(content []byte) []string {
+	var text = strings.Replace(string(content), "\r\n", "\n", -1)
+	return strings.Split(text, "\n")
+}
+
+func (d *diagnosis) scan(lines []string) {
+	var section = ""
+
+	for i, raw := range lines {
+		var line = strings.TrimSpace(raw)
+		var n = i + 1
+
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[':
+			section = d.checkSection(n, line)
+			continue
+		}
+
+		var key, value, ok = splitKeyValue(line)
+
+		switch {
+		case !ok:
+			d.add(Problem{
+				Line:        n,
+				Description: fmt.Sprintf("invalid line %q", line),
+				Repair:      "comment it out",
+				fix:         commentOut(i),
+			})
+		case section == "" || section == "DEFAULT":
+			d.checkKey(n, key, value)
+		case section == "remotes":
+			d.checkRemote(n, key, value)
+		case section == "run":
+			d.checkRunKey(n, key)
+		}
+	}
+}
+
+func (d *diagnosis) checkSection(n int, line string) string {
+	if !strings.HasSuffix(line, "]") {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("invalid section header %q", line),
+			Repair:      "comment it out",
+			fix:         commentOut(n - 1),
+		})
+
+		return ""
+	}
+
+	var section = strings.TrimSpace(line[1 : len(line)-1])
+
+	var known = globalSections
+
+	if d.project {
+		known = projectSections
+	}
+
+	if section != "DEFAULT" && !known[section] {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("unknown section %q", section),
+		})
+	}
+
+	return section
+}
+
+func (d *diagnosis) checkKey(n int, name, value string) {
+	if name == VersionKey && !d.project {
+		d.hasVersion = true
+		d.checkVersion(n, value)
+		return
+	}
+
+	var key, err = GetKey(name)
+
+	if err != nil {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("unknown key %q", name),
+			Repair:      "remove it",
+			fix:         removeLine(n - 1),
+		})
+
+		return
+	}
+
+	if d.project && key.Global {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("%v can only be set on the global configuration", name),
+			Repair:      "remove it",
+			fix:         removeLine(n - 1),
+		})
+
+		return
+	}
+
+	var scratch = &Config{}
+	scratch.setDefaults()
+
+	if err = setField(scratch.field(key), key, value); err != nil {
+		scratch.setDefaults()
+		var def = formatValue(scratch.field(key))
+
+		d.add(Problem{
+			Line:        n,
+			Description: err.Error(),
+			Repair:      fmt.Sprintf("reset it to the default value %q", def),
+			fix:         replaceLine(n-1, name+" = "+def),
+		})
+	}
+}
+
+func (d *diagnosis) checkVersion(n int, value string) {
+	var f = ini.Empty()
+	f.Section("").Key(VersionKey).SetValue(value)
+
+	var version, err = FileVersion(f)
+
+	switch {
+	case err != nil:
+		d.add(Problem{
+			Line:        n,
+			Description: err.Error(),
+			Repair:      fmt.Sprintf("migrate it to version %d", Version),
+			fix:         removeLine(n - 1),
+			migrate:     true,
+		})
+	case version < Version:
+		d.add(Problem{
+			Line: n,
+			Description: fmt.Sprintf("configuration file version %d is older than %d",
+				version, Version),
+			Repair:  fmt.Sprintf("migrate it to version %d", Version),
+			migrate: true,
+		})
+	case version > Version:
+		d.add(Problem{
+			Line: n,
+			Description: fmt.Sprintf(
+				"configuration file version %d is newer than %d: update the CLI",
+				version, Version),
+		})
+	}
+}
+
+func (d *diagnosis) checkRemote(n int, name, value string) {
+	var u, err = url.Parse(value)
+
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("remote %v has an invalid URL %q", name, value),
+		})
+	}
+}
+
+func (d *diagnosis) checkRunKey(n int, name string) {
+	if d.project && !projectRunKeys[name] {
+		d.add(Problem{
+			Line:        n,
+			Description: fmt.Sprintf("run key %q is only allowed on the global configuration", name),
+			Repair:      "remove it",
+			fix:         removeLine(n - 1),
+		})
+
+		return
+	}
+
+	var t = reflect.TypeOf(RunConfig{})
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("ini") == name {
+			return
+		}
+	}
+
+	d.add(Problem{
+		Line:        n,
+		Description: fmt.Sprintf("unknown run key %q", name),
+		Repair:      "remove it",
+		fix:         removeLine(n - 1),
+	})
+}
+
+func (d *diagnosis) add(p Problem) {
+	d.problems = append(d.problems, p)
+}
+
+func splitKeyValue(line string) (key, value string, ok bool) {
+	var i = strings.IndexAny(line, "=:")
+
+	if i < 1 {
+		return "", "", false
+	}
+
+	key = strings.TrimSpace(line[:i])
+	value = strings.TrimSpace(line[i+1:])
+
+	if len(value) > 1 && (value[0] == '"' || value[0] == '`') &&
+		value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return key, value, true
+}
+
+// line fixes keep the number of lines, so problems can be repaired in any order
+
+func commentOut(i int) func(lines []string) []string {
+	return func(lines []string) []string {
+		lines[i] = "# " + lines[i]
+		return lines
+	}
+}
+
+func replaceLine(i int, content string) func(lines []string) []string {
+	return func(lines []string) []string {
+		lines[i] = content
+		return lines
+	}
+}
+
+func removeLine(i int) func(lines []string) []string {
+	return replaceLine(i, "")
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Key of the configuration file
+type Key struct {
+	Name   string
+	Secret bool
+	Global bool
+	Kind   reflect.Kind
+	index  int
+}
+
+// InvalidValueError is used when a value doesn't match the type of a key
+type InvalidValueError struct {
+	Key   string
+	Value string
+	Kind  reflect.Kind
+}
+
+var (
+	// ErrUnknownKey is used when a key is not part of the configuration
+	ErrUnknownKey = errors.New("Unknown configuration key")
+
+	// ErrKeyNotSet is used when a key is not set on a project configuration
+	ErrKeyNotSet = errors.New("Configuration key is not set")
+
+	// ErrSecretOnProject is used when trying to store a secret on a project
+	ErrSecretOnProject = errors.New("Secret keys can only be set on the global configuration")
+
+	// ErrGlobalOnProject is used when trying to change where the credentials are sent on a project
+	ErrGlobalOnProject = errors.New("endpoint can only be set on the global configuration. " +
+		"Set remote to use one of your remotes instead")
+
+	secretKeys = map[string]bool{
+		"password": true,
+		"token":    true,
+	}
+
+	// globalKeys can't be set by a project, as the credentials are sent to the endpoint
+	globalKeys = map[string]bool{
+		"endpoint": true,
+	}
+)
+
+func (i InvalidValueError) Error() string {
+	return fmt.Sprintf("Invalid value %q for %v: expected %v", i.Value, i.Key, i.Kind)
+}
+
+// Keys returns the list of configuration keys in the order they are saved
+func Keys() []Key {
+	var t = reflect.TypeOf(Config{})
+	var keys = []Key{}
+
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		var name = field.Tag.Get("ini")
+
+		if name == "" || name == "-" {
+			continue
+		}
+
+		keys = append(keys, Key{
+			Name:   name,
+			Secret: secretKeys[name],
+			Global: secretKeys[name] || globalKeys[name],
+			Kind:   field.Type.Kind(),
+			index:  i,
+		})
+	}
+
+	return keys
+}
+
+// GetKey gets a configuration key by name
+func GetKey(name string) (Key, error) {
+	for _, k := range Keys() {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+
+	return Key{}, ErrUnknownKey
+}
+
+// Get the value of a key
+func (c *Config) Get(name string) (string, error) {
+	var key, err = GetKey(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	if c.partial && !c.file.Section("").HasKey(name) {
+		return "", ErrKeyNotSet
+	}
+
+	var value = formatValue(c.field(key))
+
+	// the global configuration file value is returned for overridden keys
+	for _, o := range c.overrides {
+		if o.Key == name && o.Project == value {
+			return o.Global, nil
+		}
+	}
+
+	return value, nil
+}
+
+// Set the value of a key
+func (c *Config) Set(name, value string) error {
+	var key, err = GetKey(name)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.partial && key.Secret:
+		return ErrSecretOnProject
+	case c.partial && key.Global:
+		return ErrGlobalOnProject
+	}
+
+	var field = c.field(key)
+
+	if err = setField(field, key, value); err != nil {
+		return err
+	}
+
+	c.file.Section("").Key(name).SetValue(formatValue(field))
+	c.dropOverride(name)
+	return nil
+}
+
+// Unset removes a key from a project configuration
+// or restores its default value on the global configuration
+func (c *Config) Unset(name string) error {
+	var key, err = GetKey(name)
+
+	if err != nil {
+		return err
+	}
+
+	if c.partial {
+		c.file.Section("").DeleteKey(name)
+		return nil
+	}
+
+	var defaults = &Config{}
+	defaults.setDefaults()
+
+	return c.Set(name, formatValue(defaults.field(key)))
+}
+
+func (c *Config) field(key Key) reflect.Value {
+	return reflect.ValueOf(c).Elem().Field(key.index)
+}
+
+func (c *Config) dropOverride(name string) {
+	var overrides = []Override{}
+
+	for _, o := range c.overrides {
+		if o.Key != name {
+			overrides = append(overrides, o)
+		}
+	}
+
+	c.overrides = overrides
+}
+
+func formatValue(field reflect.Value) string {
+	if field.Kind() == reflect.Slice {
+		return strings.Join(field.Interface().([]string), ",")
+	}
+
+	return fmt.Sprintf("%v", field.Interface())
+}
+
+func setField(field reflect.Value, key Key, value string) error {
+	switch key.Kind {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		var b, err = strconv.ParseBool(value)
+
+		if err != nil {
+			return InvalidValueError{key.Name, value, key.Kind}
+		}
+
+		field.SetBool(b)
+	case reflect.Int:
+		var i, err = strconv.Atoi(value)
+
+		if err != nil {
+			return InvalidValueError{key.Name, value, key.Kind}
+		}
+
+		field.SetInt(int64(i))
+	case reflect.Slice:
+		field.Set(reflect.ValueOf(splitList(value)))
+	default:
+		panic("Unsupported configuration key type " + key.Kind.String())
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var list = []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/ini.v1"
+)
+
+// Version of the configuration file format
+const Version = 1
+
+// VersionKey is the key storing the version of the configuration file format
+const VersionKey = "config_version"
+
+// migration upgrades a configuration file to the next version
+type migration struct {
+	description string
+	up          func(f *ini.File)
+}
+
+// migrations registry: migrations[i] upgrades a file from version i to i + 1
+var migrations = []migration{
+	{
+		description: "rename legacy keys no_color and auto_update",
+		up: func(f *ini.File) {
+			renameKey(f.Section(""), "no_color", "disable_colors")
+			renameKey(f.Section(""), "auto_update", "notify_updates")
+		},
+	},
+}
+
+// FileVersion gets the version of the format of a configuration file
+// Files created before versioning was introduced are version 0
+func FileVersion(f *ini.File) (int, error) {
+	var section = f.Section("")
+
+	if !section.HasKey(VersionKey) {
+		return 0, nil
+	}
+
+	var value = section.Key(VersionKey).Value()
+	var version, err = strconv.Atoi(value)
+
+	if err != nil || version < 0 {
+		return 0, InvalidValueError{VersionKey, value, reflect.Int}
+	}
+
+	return version, nil
+}
+
+// migrate a configuration file to the current version
+func migrate(f *ini.File, from int) {
+	for v := from; v < Version; v++ {
+		migrations[v].up(f)
+	}
+
+	setVersion(f)
+}
+
+func setVersion(f *ini.File) {
+	f.Section("").Key(VersionKey).SetValue(strconv.Itoa(Version))
+}
+
+func renameKey(section *ini.Section, from, to string) {
+	if !section.HasKey(from) {
+		return
+	}
+
+	var old = section.Key(from)
+
+	if !section.HasKey(to) {
+		var key = section.Key(to)
+		key.SetValue(old.Value())
+		key.Comment = old.Comment
+	}
+
+	section.DeleteKey(from)
+}
+
+func backupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+func backup(path, dest string) error {
+	var content, err = ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dest, content, 0600)
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+type entry struct {
+	value   string
+	comment string
+}
+
+type entryKey struct {
+	section string
+	key     string
+}
+
+type entries map[entryKey]entry
+
+// Save the configuration
+// Saving is safe to be called concurrently, including from other processes:
+// the file on disk is locked, reloaded and only the changes made since the
+// configuration was loaded (or last saved) are applied to it before it is
+// atomically replaced.
+func (c *Config) Save() {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+
+	if c.loadErr != nil {
+		verbose.Debug("Not saving broken configuration file "+c.Path+":", c.loadErr)
+		return
+	}
+
+	if !c.partial {
+		c.reflect()
+	}
+
+	if err := c.save(); err != nil {
+		panic(err)
+	}
+
+	c.setBaseline()
+}
+
+// setBaseline to detect changes made to the configuration from now on
+func (c *Config) setBaseline() {
+	c.baseline = flatten(c.file)
+	c.baselinePath = c.Path
+}
+
+func (c *Config) save() error {
+	var stat, err = os.Stat(c.Path)
+
+	// special files (such as os.DevNull) are written in place
+	if err == nil && !stat.Mode().IsRegular() {
+		return c.file.SaveTo(c.Path)
+	}
+
+	var lock *os.File
+	lock, err = acquireLock(c.Path + ".lock")
+
+	if err != nil {
+		return err
+	}
+
+	defer releaseLock(lock)
+
+	if c.migrating && c.Path == c.baselinePath {
+		return c.saveMigrated()
+	}
+
+	return writeFileAtomic(c.Path, c.reloadAndMerge())
+}
+
+// saveMigrated replaces a file of an older version, keeping a backup of it
+func (c *Config) saveMigrated() error {
+	if err := backup(c.Path, backupPath(c.Path, c.migratedFrom)); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(c.Path, c.file); err != nil {
+		return err
+	}
+
+	c.migrating = false
+	return nil
+}
+
+func (c *Config) reloadAndMerge() *ini.File {
+	if _, err := os.Stat(c.Path); os.IsNotExist(err) || c.Path != c.baselinePath {
+		return c.file
+	}
+
+	var disk, err = ini.Load(c.Path)
+
+	if err != nil {
+		verbose.Debug("Can't reload configuration file, overwriting it:", err)
+		return c.file
+	}
+
+	c.mergeChanges(disk)
+	return disk
+}
+
+// mergeChanges applies the changes made on this configuration to a file
+func (c *Config) mergeChanges(f *ini.File) {
+	var current = flatten(c.file)
+
+	for k, e := range current {
+		if b, ok := c.baseline[k]; ok && b == e {
+			continue
+		}
+
+		var key = f.Section(k.section).Key(k.key)
+		key.SetValue(e.value)
+		key.Comment = e.comment
+	}
+
+	for k := range c.baseline {
+		if _, ok := current[k]; !ok {
+			f.Section(k.section).DeleteKey(k.key)
+		}
+	}
+
+	for _, section := range f.Sections() {
+		var name = section.Name()
+
+		if name != "DEFAULT" &&
+			len(section.Keys()) == 0 && section.Comment == "" {
+			f.DeleteSection(name)
+		}
+	}
+}
+
+func flatten(f *ini.File) entries {
+	var m = entries{}
+
+	for _, section := range f.Sections() {
+		for _, key := range section.Keys() {
+			m[entryKey{section.Name(), key.Name()}] = entry{
+				value:   key.Value(),
+				comment: key.Comment,
+			}
+		}
+	}
+
+	return m
+}
+
+func acquireLock(path string) (*os.File, error) {
+	var lock, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = lockFile(lock); err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+func releaseLock(lock *os.File) {
+	if err := unlockFile(lock); err != nil {
+		verbose.Debug("Error unlocking configuration file:", err)
+	}
+
+	if err := lock.Close(); err != nil {
+		verbose.Debug("Error closing configuration lock file:", err)
+	}
+}
+
+func writeFileAtomic(path string, content io.WriterTo) error {
+	var dir, name = filepath.Split(path)
+
+	if dir == "" {
+		dir = "."
+	}
+
+	var tmp, err = ioutil.TempFile(dir, "."+name+".tmp")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = content.WriteTo(tmp); err == nil {
+		err = tmp.Sync()
+	}
+
+	if ec := tmp.Close(); err == nil {
+		err = ec
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/wedeploy/api-go"
 	"github.com/wedeploy/cli/apihelper"
 	"github.com/wedeploy/cli/hooks"
+	"github.com/wedeploy/cli/schema"
 	"github.com/wedeploy/cli/verbose"
 	"github.com/wedeploy/cli/verbosereq"
 )
@@ -31,6 +32,7 @@ type Container struct {
 	DeployIgnore []string          `json:"deploy_ignore,omitempty"`
 	Env          map[string]string `json:"env,omitempty"`
 	Instances    int               `json:"instances,omitempty"`
+	DependsOn    []string          `json:"depends_on,omitempty"`
 }
 
 // Register for the container structure
@@ -81,6 +83,12 @@ func GetStatus(projectID, containerID string) string {
 	return status
 }
 
+// GetList gets the containers of a given project
+func GetList(projectID string) (cs Containers, err error) {
+	err = apihelper.AuthGet("/projects/"+projectID+"/containers", &cs)
+	return cs, err
+}
+
 // List of containers of a given project
 func List(projectID string) {
 	var cs Containers
@@ -133,17 +141,62 @@ func Unlink(projectID, containerID string) error {
 	return apihelper.Validate(req, req.Delete())
 }
 
+// UnlinkAll unlinks every container of a project, keeping the project
+// It returns the containers unlinked before any error.
+func UnlinkAll(projectID string) (unlinked []string, err error) {
+	var cs Containers
+
+	if cs, err = GetList(projectID); err != nil {
+		return nil, err
+	}
+
+	var ids = make([]string, 0, len(cs))
+
+	for id := range cs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err = Unlink(projectID, id); err != nil {
+			return unlinked, err
+		}
+
+		unlinked = append(unlinked, id)
+	}
+
+	return unlinked, nil
+}
+
 // GetRegistry gets a list of container images
 func GetRegistry() (registry []Register) {
 	apihelper.AuthGetOrExit("/registry", &registry)
 	return registry
 }
 
-// Read a container directory properties (defined by a container.json on it)
+// Read a container directory properties
+// (defined by a container.json, container.yaml or container.toml on it)
+// The overlay of the current environment is merged over it and its variables interpolated.
 func Read(path string) (*Container, error) {
-	var content, err = ioutil.ReadFile(filepath.Join(path, "container.json"))
+	return read(path, schema.ReadFile)
+}
+
+// ReadRaw reads a container directory properties as they are on its definition,
+// without merging an overlay or interpolating variables, to change it
+func ReadRaw(path string) (*Container, error) {
+	return read(path, schema.DecodeFile)
+}
+
+func read(path string, decode func(file string) ([]byte, error)) (*Container, error) {
+	var file, err = schema.Find(path, "container")
+	var content []byte
 	var data Container
 
+	if err == nil {
+		content, err = decode(file)
+	}
+
 	if err != nil {
 		return nil, readValidate(data, err)
 	}
@@ -0,0 +1,249 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wedeploy/cli/apihelper"
+	"github.com/wedeploy/cli/schema"
+)
+
+// Instance of a container
+type Instance struct {
+	Container string `json:"containerId,omitempty"`
+	ID        string `json:"instanceId"`
+	PodName   string `json:"podName"`
+	State     string `json:"state"`
+	StartedAt int64  `json:"startedAt,omitempty"`
+	Restarts  int    `json:"restarts"`
+	Host      string `json:"host,omitempty"`
+}
+
+// ScaleTimeoutError is used when the instances don't become healthy in time
+type ScaleTimeoutError struct {
+	Want      int
+	Instances []Instance
+}
+
+// HealthyState is the state of an instance that is up
+const HealthyState = "on"
+
+var (
+	// ScaleInterval is how often the instances are checked after scaling
+	ScaleInterval = time.Second
+
+	// ScaleTimeout is how long to wait for the instances to become healthy
+	ScaleTimeout = 2 * time.Minute
+)
+
+func (s ScaleTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out waiting for %d healthy instances (%d healthy)",
+		s.Want, CountHealthy(s.Instances))
+}
+
+// Healthy tells if the instance is up
+func (i Instance) Healthy() bool {
+	return i.State == HealthyState
+}
+
+// Started is when the instance started
+func (i Instance) Started() time.Time {
+	return time.Unix(0, i.StartedAt*int64(time.Millisecond))
+}
+
+// CountHealthy counts the healthy instances
+func CountHealthy(instances []Instance) (healthy int) {
+	for _, i := range instances {
+		if i.Healthy() {
+			healthy++
+		}
+	}
+
+	return healthy
+}
+
+// GetInstances gets the instances of a container
+func GetInstances(projectID, containerID string) (instances []Instance, err error) {
+	err = apihelper.AuthGet("/projects/"+projectID+"/containers/"+containerID+"/instances",
+		&instances)
+
+	for i := range instances {
+		instances[i].Container = containerID
+	}
+
+	return instances, err
+}
+
+// GetProjectInstances gets the instances of every container of a project
+func GetProjectInstances(projectID string) ([]Instance, error) {
+	var cs, err = GetList(projectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ids = make([]string, 0, len(cs))
+
+	for id := range cs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var all = []Instance{}
+
+	for _, id := range ids {
+		var instances, ierr = GetInstances(projectID, id)
+
+		if ierr != nil {
+			return nil, ierr
+		}
+
+		all = append(all, instances...)
+	}
+
+	return all, nil
+}
+
+// PrintInstances prints a table of instances
+func PrintInstances(w io.Writer, instances []Instance, now time.Time) {
+	var tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "CONTAINER\tINSTANCE\tSTATE\tUPTIME\tRESTARTS\tHOST")
+
+	for _, i := range instances {
+		var uptime = "-"
+
+		if i.StartedAt != 0 && i.Healthy() {
+			uptime = FormatUptime(now.Sub(i.Started()))
+		}
+
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%d\t%v\n",
+			i.Container, i.ID, i.State, uptime, i.Restarts, i.Host)
+	}
+
+	if err := tw.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// FormatUptime formats a duration with its two largest units, such as 3d4h or 5m10s
+func FormatUptime(d time.Duration) string {
+	var s = int64(d / time.Second)
+
+	switch {
+	case s < 0:
+		return "0s"
+	case s < 60:
+		return fmt.Sprintf("%ds", s)
+	case s < 3600:
+		return fmt.Sprintf("%dm%ds", s/60, s%60)
+	case s < 86400:
+		return fmt.Sprintf("%dh%dm", s/3600, s%3600/60)
+	default:
+		return fmt.Sprintf("%dd%dh", s/86400, s%86400/3600)
+	}
+}
+
+// Scale changes the number of instances of a container
+func Scale(projectID, containerID string, instances int) error {
+	var req = apihelper.URL("/projects", projectID, "containers", containerID)
+	apihelper.Auth(req)
+
+	var err = apihelper.SetBody(req, map[string]int{
+		"instances": instances,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return apihelper.Validate(req, req.Patch())
+}
+
+// WaitInstances waits until a container has the given number of instances, all healthy
+// The update function is called with the instances every time they are checked.
+func WaitInstances(ctx context.Context, projectID, containerID string, want int,
+	update func([]Instance)) ([]Instance, error) {
+	var instances []Instance
+	var ticker = time.NewTicker(ScaleInterval)
+	var timeout = time.After(ScaleTimeout)
+
+	defer ticker.Stop()
+
+	for {
+		var err error
+
+		if instances, err = GetInstances(projectID, containerID); err != nil {
+			return instances, err
+		}
+
+		if update != nil {
+			update(instances)
+		}
+
+		if len(instances) == want && CountHealthy(instances) == want {
+			return instances, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return instances, ctx.Err()
+		case <-timeout:
+			return instances, ScaleTimeoutError{want, instances}
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetInstances sets the number of instances on the definition of a container directory
+// When the overlay of the current environment sets the instances, the overlay is changed instead.
+// It returns the changed file.
+func SetInstances(path string, instances int) (string, error) {
+	var file, err = schema.Find(path, "container")
+
+	if err != nil {
+		return "", err
+	}
+
+	var overlay string
+
+	switch overlay, err = schema.FindOverlay(file, schema.Environment); {
+	case err == nil:
+		if set, oerr := hasKey(overlay, "instances"); oerr != nil || set {
+			file, err = overlay, oerr
+		}
+	case os.IsNotExist(err):
+		err = nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return file, setFileKey(file, "instances", instances)
+}
+
+// hasKey tells if a definition file sets a key
+func hasKey(file, key string) (bool, error) {
+	var content, err = schema.DecodeFile(file)
+
+	if err != nil {
+		return false, err
+	}
+
+	var values map[string]json.RawMessage
+
+	if err = json.Unmarshal(content, &values); err != nil {
+		return false, fmt.Errorf("%v: %v", file, err)
+	}
+
+	var _, ok = values[key]
+	return ok, nil
+}
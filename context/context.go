@@ -4,6 +4,9 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/wedeploy/cli/schema"
 )
 
 // Context structure
@@ -11,12 +14,20 @@ type Context struct {
 	Scope         string
 	ProjectRoot   string
 	ContainerRoot string
+	ProjectConfig string
 }
 
+// ProjectConfigFiles are the accepted names for the project configuration file
+var ProjectConfigFiles = []string{"wedeploy.ini", ".we"}
+
 var (
-	// ErrContainerInProjectRoot happens when a project.json and container.json is found at the same directory level
+	// ErrContainerInProjectRoot happens when a project and a container definition are found at the same directory level
 	ErrContainerInProjectRoot = errors.New("Container and project definition files at the same directory level")
 
+	// ErrMultipleProjectConfig happens when more than one project configuration file is found
+	ErrMultipleProjectConfig = errors.New("Multiple project configuration files (" +
+		strings.Join(ProjectConfigFiles, ", ") + ") found at the project root")
+
 	sysRoot string
 )
 
@@ -28,7 +39,7 @@ func init() {
 func Get() (*Context, error) {
 	cx := &Context{}
 
-	var project, errProject = getRootDirectory(sysRoot, "project.json")
+	var project, errProject = getRootDirectory(sysRoot, schema.Files("project")...)
 
 	cx.ProjectRoot = project
 
@@ -37,7 +48,16 @@ func Get() (*Context, error) {
 		return cx, nil
 	}
 
-	var container, errContainer = getRootDirectory(project, "container.json")
+	var projectConfig, errProjectConfig = FindProjectConfig(project)
+
+	if errProjectConfig != nil {
+		cx.Scope = "project"
+		return cx, errProjectConfig
+	}
+
+	cx.ProjectConfig = projectConfig
+
+	var container, errContainer = getRootDirectory(project, schema.Files("container")...)
 
 	if errContainer != nil {
 		cx.Scope = "project"
@@ -50,34 +70,59 @@ func Get() (*Context, error) {
 	return cx, nil
 }
 
+// FindProjectConfig finds the configuration file at the project root
+// An empty path is returned when the project has no configuration file
+func FindProjectConfig(projectRoot string) (string, error) {
+	var found string
+
+	for _, name := range ProjectConfigFiles {
+		var path = filepath.Join(projectRoot, name)
+		var stat, err = os.Stat(path)
+
+		if err != nil || stat.IsDir() {
+			continue
+		}
+
+		if found != "" {
+			return "", ErrMultipleProjectConfig
+		}
+
+		found = path
+	}
+
+	return found, nil
+}
+
 func checkContainerNotInProjectRoot(projectRoot string) error {
-	stat, err := os.Stat(filepath.Join(projectRoot, "container.json"))
+	for _, file := range schema.Files("container") {
+		stat, err := os.Stat(filepath.Join(projectRoot, file))
 
-	if err == nil && !stat.IsDir() {
-		return ErrContainerInProjectRoot
+		if err == nil && !stat.IsDir() {
+			return ErrContainerInProjectRoot
+		}
 	}
 
 	return nil
 }
 
-func walkToRootDirectory(dir, delimiter, file string) (string, error) {
+// walkToRootDirectory finds the closest directory with any of the files
+func walkToRootDirectory(dir, delimiter string, files ...string) (string, error) {
 	// sysRoot = / = upper-bound / The Power of Ten rule 2
 	for !isRootDelimiter(dir) && dir != delimiter {
-		stat, err := os.Stat(filepath.Join(dir, file))
-
-		if stat == nil {
-			dir = filepath.Join(dir, "..")
-			dir, _ = filepath.Abs(dir)
-			continue
+		for _, file := range files {
+			if stat, err := os.Stat(filepath.Join(dir, file)); stat != nil {
+				return dir, err
+			}
 		}
 
-		return dir, err
+		dir = filepath.Join(dir, "..")
+		dir, _ = filepath.Abs(dir)
 	}
 
 	return "", os.ErrNotExist
 }
 
-func getRootDirectory(delimiter, file string) (dir string, err error) {
+func getRootDirectory(delimiter string, files ...string) (dir string, err error) {
 	dir, err = os.Getwd()
 
 	if err != nil {
@@ -90,7 +135,7 @@ func getRootDirectory(delimiter, file string) (dir string, err error) {
 		return "", os.ErrNotExist
 	}
 
-	return walkToRootDirectory(dir, delimiter, file)
+	return walkToRootDirectory(dir, delimiter, files...)
 }
 
 func setSysRoot(dir string) {
@@ -216,6 +216,63 @@ func TestInvalidContext(t *testing.T) {
 	setSysRoot("/")
 }
 
+func TestProjectConfigContext(t *testing.T) {
+	setSysRoot("./mocks")
+	var projectDir = filepath.Join(workingDir, "mocks/project-with-config")
+	chdir(projectDir)
+
+	var context, err = Get()
+
+	if err != nil {
+		t.Errorf("Unexpected context error: %v", err)
+	}
+
+	var want = filepath.Join(projectDir, ".we")
+
+	if context.ProjectConfig != want {
+		t.Errorf("Wanted project config %s, got %s instead", want, context.ProjectConfig)
+	}
+
+	chdir(workingDir)
+	setSysRoot("/")
+}
+
+func TestProjectWithoutConfigContext(t *testing.T) {
+	setSysRoot("./mocks")
+	chdir(filepath.Join(workingDir, "mocks/project"))
+
+	var context, err = Get()
+
+	if err != nil {
+		t.Errorf("Unexpected context error: %v", err)
+	}
+
+	if context.ProjectConfig != "" {
+		t.Errorf("Expected project config to be empty, got %s instead", context.ProjectConfig)
+	}
+
+	chdir(workingDir)
+	setSysRoot("/")
+}
+
+func TestMultipleProjectConfigContext(t *testing.T) {
+	setSysRoot("./mocks")
+	chdir(filepath.Join(workingDir, "mocks/project-with-configs"))
+
+	var context, err = Get()
+
+	if err != ErrMultipleProjectConfig {
+		t.Errorf("Expected error to be %v, got %v instead", ErrMultipleProjectConfig, err)
+	}
+
+	if context.Scope != "project" {
+		t.Errorf("Expected context type to be project, got %s instead", context.Scope)
+	}
+
+	chdir(workingDir)
+	setSysRoot("/")
+}
+
 func chdir(dir string) {
 	if ech := os.Chdir(dir); ech != nil {
 		panic(ech)
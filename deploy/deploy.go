@@ -2,6 +2,7 @@ package deploy
 
 import (
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 
 	"github.com/dustin/go-humanize"
 	"github.com/wedeploy/api-go"
@@ -19,6 +21,8 @@ import (
 	"github.com/wedeploy/cli/pod"
 	"github.com/wedeploy/cli/progress"
 	"github.com/wedeploy/cli/projects"
+	"github.com/wedeploy/cli/schema"
+	"github.com/wedeploy/cli/secrets"
 	"github.com/wedeploy/cli/verbose"
 )
 
@@ -29,8 +33,14 @@ type Deploy struct {
 	ContainerPath string
 	PackageSize   uint64
 	progress      *deployProgress
+
+	// definition is the resolved container definition as JSON,
+	// sent when it isn't the container.json of the package as is
+	definition []byte
 }
 
+var errStream io.Writer = os.Stderr
+
 // Flags modifiers
 type Flags struct {
 	Quiet bool
@@ -69,33 +79,103 @@ func New(cpath string) (*Deploy, error) {
 		return nil, err
 	}
 
+	var projectPath = filepath.Join(deploy.ContainerPath, "..")
+
+	if err = schema.CheckDir(projectPath, "project", schema.Project(), errStream); err != nil {
+		return nil, err
+	}
+
+	if err = schema.CheckDir(deploy.ContainerPath, "container", schema.Container(), errStream); err != nil {
+		return nil, err
+	}
+
+	if deploy.definition, err = resolvedDefinition(deploy.ContainerPath); err != nil {
+		return nil, err
+	}
+
 	return deploy, err
 }
 
+// resolvedDefinition gets the resolved container definition as JSON,
+// unless it is the same as the container.json of the package
+// Definitions on other formats, with an overlay or with variables are resolved.
+// ${VAR} and ${VAR:-default} are read from the process environment or the --vars file,
+// and $$ is a literal $, such as "PRICE": "$$5". Hooks aren't interpolated.
+func resolvedDefinition(dir string) ([]byte, error) {
+	var file, err = schema.Find(dir, "container")
+	var original, resolved []byte
+
+	if err == nil {
+		resolved, err = schema.ReadFile(file)
+	}
+
+	if err == nil {
+		original, err = ioutil.ReadFile(file)
+	}
+
+	if err != nil || (schema.Format(file) == "JSON" && sameJSON(original, resolved)) {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+
+	return json.Unmarshal(a, &va) == nil &&
+		json.Unmarshal(b, &vb) == nil &&
+		reflect.DeepEqual(va, vb)
+}
+
 // Deploy POD to WeDeploy
+// Encrypted environment variables are decrypted in memory and sent
+// on the env field, as the package only has their encrypted form.
 func (d *Deploy) Deploy(src string) error {
-	var request, file, err = d.setupPackage(src)
+	var env, err = d.decryptedEnv()
 
-	switch {
-	case err != nil:
+	if err != nil {
 		return err
+	}
+
+	var request, file, errPackage = d.setupPackage(src)
+
+	switch {
+	case errPackage != nil:
+		return errPackage
 	default:
-		return d.deployUpload(request, file, &writeCounter{
+		return d.deployUpload(request, file, env, d.definition, &writeCounter{
 			progress: d.progress.bar,
 			Size:     d.PackageSize,
 		})
 	}
 }
 
+func (d *Deploy) decryptedEnv() ([]byte, error) {
+	if !secrets.HasEncrypted(d.Container.Env) {
+		return nil, nil
+	}
+
+	var env, err = secrets.Decrypted(d.Project.ID, d.Container.Env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(env)
+}
+
 type deploySubmission struct {
 	emc chan error
 	mpw *multipart.Writer
 	pw  io.Closer
 	rc  io.ReadCloser
+	env []byte
+	def []byte
 }
 
 func (ds *deploySubmission) Writer() {
-	ds.emc <- multipartWriter(ds.mpw, ds.pw, ds.rc)
+	ds.emc <- multipartWriter(ds.mpw, ds.pw, ds.rc, ds.env, ds.def)
 }
 
 func (ds *deploySubmission) Setup(rc io.ReadCloser) *io.PipeReader {
@@ -108,8 +188,8 @@ func (ds *deploySubmission) Setup(rc io.ReadCloser) *io.PipeReader {
 }
 
 func (d *Deploy) deployUpload(
-	request *wedeploy.WeDeploy, rc io.ReadCloser, wc io.Writer) error {
-	var ds = &deploySubmission{}
+	request *wedeploy.WeDeploy, rc io.ReadCloser, env, def []byte, wc io.Writer) error {
+	var ds = &deploySubmission{env: env, def: def}
 	var pr = ds.Setup(rc)
 
 	go ds.Writer()
@@ -155,6 +235,7 @@ func (d *Deploy) Pack(dest string) (err error) {
 	dest, _ = filepath.Abs(dest)
 
 	var ignorePatterns = append(d.Container.DeployIgnore, pod.CommonIgnorePatterns...)
+	ignorePatterns = append(ignorePatterns, config.Global.DeployIgnore...)
 
 	_, err = pod.Pack(pod.PackParams{
 		RelDest:        dest,
@@ -193,7 +274,19 @@ func getPackageSHA1(file io.ReadSeeker) (string, error) {
 }
 
 func multipartWriter(
-	mpw *multipart.Writer, w io.Closer, file io.ReadCloser) error {
+	mpw *multipart.Writer, w io.Closer, file io.ReadCloser, env, def []byte) error {
+	if env != nil {
+		if err := mpw.WriteField("env", string(env)); err != nil {
+			return err
+		}
+	}
+
+	if def != nil {
+		if err := mpw.WriteField("container", string(def)); err != nil {
+			return err
+		}
+	}
+
 	var part, err = mpw.CreateFormFile("pod", "container.pod")
 
 	if err != nil {
@@ -296,10 +389,10 @@ func remove(path string) {
 	}
 }
 
-func (d *Deploy) runHook(df *Flags, wdir, path string) error {
+func (d *Deploy) runHook(df *Flags, wdir, name, path string) error {
 	var ch = d.Container.Hooks
 
-	if df.Hooks && ch != nil && path != "" {
+	if df.Hooks && ch != nil && path != "" && isHookEnabled(name) {
 		chdir(d.ContainerPath)
 		var err = hooks.Run(path)
 		chdir(wdir)
@@ -310,6 +403,23 @@ func (d *Deploy) runHook(df *Flags, wdir, path string) error {
 	return nil
 }
 
+// isHookEnabled checks if a hook is on the list of hooks to run (all by default)
+func isHookEnabled(name string) bool {
+	var enabled = config.Global.Hooks
+
+	if len(enabled) == 0 {
+		return true
+	}
+
+	for _, e := range enabled {
+		if e == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (d *Deploy) runBeforeHook(df *Flags, wdir string) error {
 	var hooks = d.Container.Hooks
 
@@ -317,7 +427,7 @@ func (d *Deploy) runBeforeHook(df *Flags, wdir string) error {
 	case nil:
 		return nil
 	default:
-		return d.runHook(df, wdir, hooks.BeforeDeploy)
+		return d.runHook(df, wdir, "before_deploy", hooks.BeforeDeploy)
 	}
 }
 
@@ -328,7 +438,7 @@ func (d *Deploy) runAfterHook(df *Flags, wdir string) error {
 	case nil:
 		return nil
 	default:
-		return d.runHook(df, wdir, hooks.AfterDeploy)
+		return d.runHook(df, wdir, "after_deploy", hooks.AfterDeploy)
 	}
 }
 
@@ -0,0 +1,50 @@
+package integration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertExistingDestination(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "we-convert")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	var source = filepath.Join(dir, "container.yaml")
+	var dest = filepath.Join(dir, "container.json")
+
+	if err = ioutil.WriteFile(source, []byte("id: email\n"), 0644); err != nil {
+		panic(err)
+	}
+
+	if err = ioutil.WriteFile(dest, []byte(`{"id": "web"}`), 0644); err != nil {
+		panic(err)
+	}
+
+	var cmd = &Command{
+		Args: []string{"convert", "--to", "json", source},
+		Dir:  dir,
+	}
+
+	var e = &Expect{
+		Stderr:   "fatal: " + dest + " already exists: remove it to convert " + source + ".",
+		ExitCode: 1,
+	}
+
+	cmd.Run()
+	e.Assert(t, cmd)
+
+	if content, err := ioutil.ReadFile(dest); err != nil || string(content) != `{"id": "web"}` {
+		t.Errorf("Expected %v to be kept, got %v (error: %v) instead", dest, string(content), err)
+	}
+
+	if _, err = os.Stat(source); err != nil {
+		t.Errorf("Expected %v to be kept, got %v instead", source, err)
+	}
+}
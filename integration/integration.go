@@ -155,8 +155,9 @@ func (cmd *Command) setEnv() {
 		panic(err)
 	}
 
-	cmd.Env = append(cmd.Env, "WEDEPLOY_CUSTOM_HOME="+ch)
-	cmd.Env = append(cmd.Env, os.Environ()...)
+	// the last value of a variable wins, so the command environment goes last
+	var env = append(os.Environ(), "WEDEPLOY_CUSTOM_HOME="+ch)
+	cmd.Env = append(env, cmd.Env...)
 }
 
 func build() {
@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wedeploy/cli/config"
+)
+
+func TestRemoteCheckCredentials(t *testing.T) {
+	var server = httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/version":
+				fmt.Fprintf(w, `{"version": "1.2.3"}`)
+			case r.Header.Get("Authorization") == "Bearer abc":
+				fmt.Fprintf(w, "[]")
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+
+	defer server.Close()
+
+	var home, err = ioutil.TempDir("", "we-remote-check")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(home)
+
+	var certFile = filepath.Join(home, "cert.pem")
+	var cert = pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+
+	if err = ioutil.WriteFile(certFile, cert, 0600); err != nil {
+		panic(err)
+	}
+
+	var c = &config.Config{
+		Path: filepath.Join(home, ".we"),
+	}
+
+	c.Load()
+	c.Endpoint = server.URL
+	c.Username = "foo"
+	c.Token = "abc"
+	c.Remotes.Set("prod", server.URL)
+	c.Save()
+
+	// --local is on by default, but the remotes are checked with the user credentials
+	var cmd = &Command{
+		Args: []string{"remote", "check", "prod"},
+		Env: []string{
+			"WEDEPLOY_CUSTOM_HOME=" + home,
+			"SSL_CERT_FILE=" + certFile,
+		},
+	}
+
+	cmd.Run()
+
+	if cmd.ExitCode != 0 {
+		t.Errorf("Expected remote check to pass, got exit code %v instead: %v",
+			cmd.ExitCode, cmd.Stderr.String())
+	}
+
+	if !strings.Contains(cmd.Stdout.String(), "credentials: valid") {
+		t.Errorf("Expected credentials to be valid, got %v instead", cmd.Stdout.String())
+	}
+}
@@ -0,0 +1,41 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunDryRunFlagsWithCommas(t *testing.T) {
+	var docker = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "[]")
+		}))
+
+	defer docker.Close()
+
+	var cmd = &Command{
+		Args: []string{"run", "--dry-run", "--host-ip", "10.0.0.1",
+			"-e", "JAVA_OPTS=-Xms1g,-Xmx2g",
+			"--volume", "/home/me/a,b:/data"},
+		Env: []string{
+			"WEDEPLOY_DOCKER_BACKEND=api",
+			"DOCKER_HOST=" + strings.Replace(docker.URL, "http://", "tcp://", 1),
+		},
+	}
+
+	cmd.Run()
+
+	if cmd.ExitCode != 0 {
+		t.Errorf("Expected dry run to pass, got exit code %v instead: %v",
+			cmd.ExitCode, cmd.Stderr.String())
+	}
+
+	for _, want := range []string{"-e JAVA_OPTS=-Xms1g,-Xmx2g", "-v /home/me/a,b:/data"} {
+		if !strings.Contains(cmd.Stdout.String(), want) {
+			t.Errorf("Expected %v on the docker command, got %v instead", want, cmd.Stdout.String())
+		}
+	}
+}
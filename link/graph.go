@@ -0,0 +1,121 @@
+package link
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+// CycleError is used when the dependencies of the containers form a cycle
+type CycleError struct {
+	Cycle []string
+}
+
+// DependencyError is used when a container isn't linked
+// because a container it depends on failed to link
+type DependencyError struct {
+	Dependency string
+}
+
+func (c CycleError) Error() string {
+	return "Dependency cycle: " + strings.Join(c.Cycle, " -> ")
+}
+
+func (d DependencyError) Error() string {
+	return fmt.Sprintf("Not linked: depends on container %v, which failed to link", d.Dependency)
+}
+
+// Waves orders the links so that each wave only depends on the previous ones
+// Dependencies on containers not on the list are considered linked already.
+func Waves(links []*Link) ([][]*Link, error) {
+	var byID = map[string]*Link{}
+
+	for _, l := range links {
+		byID[l.Container.ID] = l
+	}
+
+	var done = map[string]bool{}
+	var waves = [][]*Link{}
+	var remaining = links
+
+	for len(remaining) != 0 {
+		var wave, next = []*Link{}, []*Link{}
+
+		for _, l := range remaining {
+			if dependenciesDone(l, byID, done) {
+				wave = append(wave, l)
+			} else {
+				next = append(next, l)
+			}
+		}
+
+		if len(wave) == 0 {
+			return waves, CycleError{findCycle(next, byID)}
+		}
+
+		for _, l := range wave {
+			done[l.Container.ID] = true
+		}
+
+		waves = append(waves, wave)
+		remaining = next
+	}
+
+	return waves, nil
+}
+
+func dependenciesDone(l *Link, byID map[string]*Link, done map[string]bool) bool {
+	for _, dep := range l.Container.DependsOn {
+		if _, ok := byID[dep]; !ok {
+			verbose.Debug("Container", l.Container.ID, "depends on", dep,
+				"which is not being linked")
+			continue
+		}
+
+		if !done[dep] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findCycle finds a cycle among links that all wait on each other
+func findCycle(blocked []*Link, byID map[string]*Link) []string {
+	var ids = []string{}
+	var isBlocked = map[string]bool{}
+
+	for _, l := range blocked {
+		ids = append(ids, l.Container.ID)
+		isBlocked[l.Container.ID] = true
+	}
+
+	sort.Strings(ids)
+
+	// every blocked container depends on another blocked one,
+	// so following them from any start always loops
+	var path = []string{}
+	var seen = map[string]int{}
+	var current = ids[0]
+
+	for {
+		if i, ok := seen[current]; ok {
+			return append(path[i:], current)
+		}
+
+		seen[current] = len(path)
+		path = append(path, current)
+
+		var deps = append([]string{}, byID[current].Container.DependsOn...)
+		sort.Strings(deps)
+
+		for _, dep := range deps {
+			if isBlocked[dep] {
+				current = dep
+				break
+			}
+		}
+	}
+}
@@ -1,16 +1,22 @@
 package link
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/wedeploy/cli/apihelper"
 	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/projects"
+	"github.com/wedeploy/cli/schema"
+	"github.com/wedeploy/cli/secrets"
 	"github.com/wedeploy/cli/verbose"
 )
 
@@ -18,21 +24,34 @@ import (
 type Machine struct {
 	Project      *projects.Project
 	ProjectPath  string
+	Parallel     int
 	Success      []string
+	Linked       []string
 	Errors       *Errors
 	FErrStream   io.Writer
 	FOutStream   io.Writer
 	SuccessMutex sync.Mutex
 	ErrorsMutex  sync.Mutex
-	dirMutex     sync.Mutex
 	queue        sync.WaitGroup
 }
 
+var (
+	// DefaultParallel is how many containers are linked at the same time by default
+	DefaultParallel = 4
+
+	// Retries is how many times linking a container is retried on transient errors
+	Retries = 2
+
+	// RetryDelay is the wait before the first retry, doubled on each retry
+	RetryDelay = time.Second
+)
+
 // Link holds the information of container to be linked
 type Link struct {
 	Project       *projects.Project
 	Container     *containers.Container
 	ContainerPath string
+	dir           string
 }
 
 // ContainerError struct
@@ -83,6 +102,10 @@ func (m *Machine) Setup(projectPath string) error {
 		return err
 	}
 
+	if err = schema.CheckDir(projectPath, "project", schema.Project(), m.FErrStream); err != nil {
+		return err
+	}
+
 	m.Project = project
 	m.ProjectPath = projectPath
 
@@ -90,8 +113,13 @@ func (m *Machine) Setup(projectPath string) error {
 }
 
 func (m *Machine) createProject() error {
-	created, err := projects.ValidateOrCreate(
-		filepath.Join(m.ProjectPath, "project.json"))
+	file, err := schema.Find(m.ProjectPath, "project")
+
+	if err != nil {
+		return err
+	}
+
+	created, err := projects.ValidateOrCreate(file)
 
 	if created {
 		m.logSuccess("New project " + m.Project.ID + " created")
@@ -117,39 +145,199 @@ func (m *Machine) condAuthProject() error {
 }
 
 // Run links the containers of the list input
+// Containers are linked in waves, after the containers they depend on.
 func (m *Machine) Run(list []string) {
+	m.RunContext(context.Background(), list)
+}
+
+// RunContext links the containers of the list input until the context is canceled
+// Containers not linked because of the cancellation fail with the context error.
+func (m *Machine) RunContext(ctx context.Context, list []string) {
+	m.reset()
+	m.runLinks(ctx, m.read(list))
+}
+
+func (m *Machine) reset() {
 	m.Errors = &Errors{
 		List: []ContainerError{},
 	}
 
-	m.queue.Add(len(list))
+	m.Linked = []string{}
+}
+
+// runLinks links in waves, after the containers they depend on
+func (m *Machine) runLinks(ctx context.Context, links []*Link) {
+	var waves, err = Waves(links)
+
+	if err != nil {
+		m.logBlocked(links, waves, err)
+	}
+
+	var failed = map[string]bool{}
+
+	for _, wave := range waves {
+		m.runWave(ctx, wave, failed)
+	}
+}
+
+func (m *Machine) read(list []string) []*Link {
+	var links = []*Link{}
 
 	for _, dir := range list {
-		go m.start(dir)
+		var l, err = New(m.Project, filepath.Join(m.ProjectPath, dir))
+
+		if err == nil {
+			err = schema.CheckDir(l.ContainerPath, "container", schema.Container(), m.FErrStream)
+		}
+
+		if err != nil {
+			m.logError(dir, err)
+			continue
+		}
+
+		l.dir = dir
+		links = append(links, l)
+	}
+
+	return links
+}
+
+// logBlocked logs the error for the links left out of the waves
+func (m *Machine) logBlocked(links []*Link, waves [][]*Link, err error) {
+	var ordered = map[*Link]bool{}
+
+	for _, wave := range waves {
+		for _, l := range wave {
+			ordered[l] = true
+		}
+	}
+
+	for _, l := range links {
+		if !ordered[l] {
+			m.logError(l.dir, err)
+		}
+	}
+}
+
+func (m *Machine) runWave(ctx context.Context, wave []*Link, failed map[string]bool) {
+	var results = make([]error, len(wave))
+	var workers = make(chan bool, m.parallel())
+
+	for i, l := range wave {
+		if ctx.Err() != nil {
+			results[i] = ctx.Err()
+			continue
+		}
+
+		if dep := failedDependency(l, failed); dep != "" {
+			results[i] = DependencyError{dep}
+			continue
+		}
+
+		select {
+		case workers <- true:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			results[i] = ctx.Err()
+			continue
+		}
+
+		m.queue.Add(1)
+		go m.start(ctx, l, &results[i], workers)
 	}
 
 	m.queue.Wait()
+
+	for i, err := range results {
+		if err != nil {
+			failed[wave[i].Container.ID] = true
+			m.logError(wave[i].dir, err)
+		}
+	}
 }
 
-func (m *Machine) start(dir string) {
-	var err = m.mountAndLink(dir)
+func failedDependency(l *Link, failed map[string]bool) string {
+	for _, dep := range l.Container.DependsOn {
+		if failed[dep] {
+			return dep
+		}
+	}
 
-	if err != nil {
-		m.logError(dir, err)
+	return ""
+}
+
+func (m *Machine) parallel() int {
+	if m.Parallel < 1 {
+		return DefaultParallel
 	}
 
+	return m.Parallel
+}
+
+func (m *Machine) start(ctx context.Context, l *Link, result *error, workers chan bool) {
+	// each goroutine writes only its own result
+	*result = m.linkRetry(ctx, l)
+
+	if *result == nil {
+		m.successFeedback(l.Container.ID)
+	}
+
+	<-workers
 	m.queue.Done()
 }
 
+// linkRetry links a container, retrying on transient errors
+func (m *Machine) linkRetry(ctx context.Context, l *Link) error {
+	var delay = RetryDelay
+
+	for retry := 1; ; retry++ {
+		var err = m.link(l)
+
+		if err == nil || retry > Retries || !isTransient(err) {
+			return err
+		}
+
+		verbose.Debug(fmt.Sprintf("Retrying to link %v (#%d) in %v: %v",
+			l.Container.ID, retry, delay, err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// isTransient tells if an error might go away by trying again
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *apihelper.APIFault:
+		return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+	case net.Error:
+		return true
+	}
+
+	return false
+}
+
 func (m *Machine) link(l *Link) error {
-	m.dirMutex.Lock()
-	var err = containers.Link(m.Project.ID,
-		l.ContainerPath,
-		l.Container)
-	m.dirMutex.Unlock()
-	runtime.Gosched()
+	// secrets are decrypted on a copy, never on the definition read from disk
+	var c = *l.Container
+	var env, err = secrets.Decrypted(m.Project.ID, c.Env)
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	c.Env = env
+
+	return containers.Link(m.Project.ID,
+		l.ContainerPath,
+		&c)
 }
 
 func (m *Machine) logError(dir string, err error) {
@@ -166,6 +354,7 @@ func (m *Machine) logError(dir string, err error) {
 	m.ErrorsMutex.Unlock()
 }
 
+// check validates the definition of a directory, printing its warnings
 func (m *Machine) logSuccess(msg string) {
 	m.SuccessMutex.Lock()
 	m.Success = append(m.Success, msg)
@@ -180,24 +369,12 @@ func (m *Machine) logSuccess(msg string) {
 func (m *Machine) successFeedback(containerID string) {
 	var host = "wedeploy.me"
 
+	m.SuccessMutex.Lock()
+	m.Linked = append(m.Linked, containerID)
+	m.SuccessMutex.Unlock()
+
 	m.logSuccess(fmt.Sprintf("Ready! %v.%v.%v",
 		containerID,
 		m.Project.ID,
 		host))
 }
-
-func (m *Machine) mountAndLink(dir string) error {
-	var l, err = New(m.Project, filepath.Join(m.ProjectPath, dir))
-
-	if err != nil {
-		return err
-	}
-
-	err = m.link(l)
-
-	if err == nil {
-		m.successFeedback(l.Container.ID)
-	}
-
-	return err
-}
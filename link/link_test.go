@@ -1,16 +1,25 @@
 package link
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/wedeploy/cli/apihelper"
 	"github.com/wedeploy/cli/containers"
 	"github.com/wedeploy/cli/globalconfigmock"
 	"github.com/wedeploy/cli/projects"
+	"github.com/wedeploy/cli/secrets"
 	"github.com/wedeploy/cli/servertest"
 	"github.com/wedeploy/cli/tdata"
 )
@@ -266,3 +275,559 @@ func TestAllInstallContainerError(t *testing.T) {
 	globalconfigmock.Teardown()
 	servertest.Teardown()
 }
+
+func copyMockProject(src string) string {
+	var dest, err = ioutil.TempDir(os.TempDir(), "we-link")
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = filepath.Walk(src, func(path string, fi os.FileInfo, ierr error) error {
+		if ierr != nil {
+			return ierr
+		}
+
+		var relative, _ = filepath.Rel(src, path)
+		var target = filepath.Join(dest, relative)
+
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		var content, rerr = ioutil.ReadFile(path)
+
+		if rerr != nil {
+			return rerr
+		}
+
+		return ioutil.WriteFile(target, content, 0644)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return dest
+}
+
+func TestWatch(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var defaultPollInterval = PollInterval
+	var defaultDebounce = Debounce
+
+	PollInterval = 5 * time.Millisecond
+	Debounce = 20 * time.Millisecond
+
+	var dir = copyMockProject("mocks/myproject")
+	var mutex sync.Mutex
+	var linked, unlinked int
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			linked++
+			mutex.Unlock()
+		})
+
+	servertest.Mux.HandleFunc("/deploy/project/container",
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodDelete {
+				t.Errorf("Expected unlink method to be DELETE, got %v instead", r.Method)
+			}
+
+			mutex.Lock()
+			unlinked++
+			mutex.Unlock()
+		})
+
+	var out bytes.Buffer
+	var m = Machine{
+		FOutStream: &out,
+	}
+
+	if err := m.Setup(dir); err != nil {
+		panic(err)
+	}
+
+	out.Reset()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var done = make(chan error, 1)
+
+	go func() {
+		done <- m.Watch(ctx, []string{"mycontainer"})
+	}()
+
+	var write = func(name, content string) {
+		var path = filepath.Join(dir, "mycontainer", name)
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	time.Sleep(10 * PollInterval)
+	write(".DS_Store", "ignored")
+	time.Sleep(Debounce + 10*PollInterval)
+
+	// changes in a burst are relinked once
+	write("index.html", "hello")
+	write("style.css", "body {}")
+	time.Sleep(PollInterval)
+	write("index.html", "hello, world")
+	time.Sleep(Debounce + 10*PollInterval)
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected watch to end cleanly, got %v instead", err)
+	}
+
+	mutex.Lock()
+
+	if linked != 1 || unlinked != 1 {
+		t.Errorf("Expected container to be relinked once, got %v links and %v unlinks instead",
+			linked, unlinked)
+	}
+
+	mutex.Unlock()
+
+	var want = "Change detected on mycontainer/, relinking\n" +
+		"Ready! container.project.wedeploy.me\n"
+
+	if out.String() != want {
+		t.Errorf("Wanted output %q, got %q instead", want, out.String())
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		panic(err)
+	}
+
+	PollInterval = defaultPollInterval
+	Debounce = defaultDebounce
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func newTestLink(id string, dependsOn ...string) *Link {
+	return &Link{
+		Container: &containers.Container{
+			ID:        id,
+			DependsOn: dependsOn,
+		},
+		dir: id,
+	}
+}
+
+func wavesIDs(waves [][]*Link) [][]string {
+	var ids = [][]string{}
+
+	for _, wave := range waves {
+		var w = []string{}
+
+		for _, l := range wave {
+			w = append(w, l.Container.ID)
+		}
+
+		ids = append(ids, w)
+	}
+
+	return ids
+}
+
+func TestWaves(t *testing.T) {
+	var waves, err = Waves([]*Link{
+		newTestLink("web", "auth", "data"),
+		newTestLink("auth", "data"),
+		newTestLink("data"),
+		newTestLink("email"),
+		newTestLink("hosting", "unlisted"),
+	})
+
+	var want = [][]string{
+		{"data", "email", "hosting"},
+		{"auth"},
+		{"web"},
+	}
+
+	if got := wavesIDs(waves); !reflect.DeepEqual(got, want) || err != nil {
+		t.Errorf("Wanted waves %v, got %v, %v instead", want, got, err)
+	}
+}
+
+func TestWavesCycle(t *testing.T) {
+	var waves, err = Waves([]*Link{
+		newTestLink("data"),
+		newTestLink("web", "auth"),
+		newTestLink("auth", "email", "data"),
+		newTestLink("email", "web"),
+	})
+
+	var want = [][]string{{"data"}}
+
+	if got := wavesIDs(waves); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted waves before the cycle %v, got %v instead", want, got)
+	}
+
+	var wantErr = "Dependency cycle: auth -> email -> web -> auth"
+
+	if _, ok := err.(CycleError); !ok || err.Error() != wantErr {
+		t.Errorf("Wanted error %v, got %v instead", wantErr, err)
+	}
+
+	if _, err = Waves([]*Link{newTestLink("self", "self")}); err == nil ||
+		err.Error() != "Dependency cycle: self -> self" {
+		t.Errorf("Expected self dependency cycle error, got %v instead", err)
+	}
+}
+
+func TestRunDependencies(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var mutex sync.Mutex
+	var order = []string{}
+	var fail = ""
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			var c containers.Container
+
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				panic(err)
+			}
+
+			mutex.Lock()
+			order = append(order, c.ID)
+			mutex.Unlock()
+
+			if c.ID == fail {
+				w.WriteHeader(403)
+			}
+		})
+
+	var m Machine
+
+	if err := m.Setup("mocks/dependencies"); err != nil {
+		panic(err)
+	}
+
+	m.Run([]string{"web", "auth", "data"})
+
+	var want = []string{"data", "auth", "web"}
+
+	if !reflect.DeepEqual(order, want) || len(m.Errors.List) != 0 {
+		t.Errorf("Wanted link order %v, got %v, %v instead", want, order, m.Errors)
+	}
+
+	order = []string{}
+	fail = "data"
+	m.Run([]string{"web", "auth", "data"})
+
+	if !reflect.DeepEqual(order, []string{"data"}) {
+		t.Errorf("Expected only data to be linked, got %v instead", order)
+	}
+
+	var wantErrors = map[string]error{
+		"auth": DependencyError{"data"},
+		"web":  DependencyError{"auth"},
+	}
+
+	for _, e := range m.Errors.List {
+		if want, ok := wantErrors[e.ContainerPath]; ok && e.Error != want {
+			t.Errorf("Wanted error %v for %v, got %v instead", want, e.ContainerPath, e.Error)
+		}
+	}
+
+	if len(m.Errors.List) != 3 {
+		t.Errorf("Expected 3 errors, got %v instead", m.Errors)
+	}
+
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func TestGetPlan(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var exists = false
+
+	servertest.Mux.HandleFunc("/projects/dependencies",
+		func(w http.ResponseWriter, r *http.Request) {
+			if !exists {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, `{"code": 404, "message": "Not Found"}`)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": "dependencies"}`)
+		})
+
+	servertest.Mux.HandleFunc("/projects/dependencies/containers",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"data": {"id": "data"}, "old": {"id": "old"}}`)
+		})
+
+	var plan, err = GetPlan("mocks/dependencies", []string{"web", "data"})
+
+	if err != nil {
+		panic(err)
+	}
+
+	if !plan.CreateProject || len(plan.Update) != 0 || len(plan.NotLocal) != 0 ||
+		!reflect.DeepEqual(plan.Add, []string{"web", "data"}) {
+		t.Errorf("Unexpected plan for a new project %+v", plan)
+	}
+
+	exists = true
+
+	if plan, err = GetPlan("mocks/dependencies", []string{"web", "data", "nil"}); err != nil {
+		panic(err)
+	}
+
+	var out bytes.Buffer
+	plan.Print(&out)
+
+	var want = `Containers to add:
+  + web
+Containers to update:
+  ~ data
+Remote containers not present locally (left untouched):
+  ! old
+List of errors (format is container path: error)
+nil: Container not found
+`
+
+	if out.String() != want {
+		t.Errorf("Wanted plan %v, got %v instead", want, out.String())
+	}
+
+	out.Reset()
+	plan.Prune = true
+	plan.Print(&out)
+
+	if !strings.Contains(out.String(), "(to unlink):\n  - old\n") {
+		t.Errorf("Expected plan to unlink old, got %v instead", out.String())
+	}
+
+	var orphans []string
+
+	if orphans, err = Orphans("mocks/dependencies", "dependencies"); err != nil {
+		panic(err)
+	}
+
+	if !reflect.DeepEqual(orphans, []string{"old"}) {
+		t.Errorf("Wanted orphans [old], got %v instead", orphans)
+	}
+
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func TestRunParallel(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var mutex sync.Mutex
+	var running, max int
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			running++
+
+			if running > max {
+				max = running
+			}
+
+			mutex.Unlock()
+			time.Sleep(50 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+		})
+
+	var m = Machine{
+		Parallel: 2,
+	}
+
+	if err := m.Setup("mocks/parallel"); err != nil {
+		panic(err)
+	}
+
+	m.Run([]string{"one", "two", "three", "four", "five", "six"})
+
+	if len(m.Errors.List) != 0 || len(m.Linked) != 6 {
+		t.Errorf("Expected all containers to be linked, got %v, %v instead", m.Linked, m.Errors)
+	}
+
+	if max != 2 {
+		t.Errorf("Expected 2 containers to be linked at the same time, got %v instead", max)
+	}
+
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func TestRunRetry(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var defaultRetryDelay = RetryDelay
+	RetryDelay = time.Millisecond
+
+	var attempts int
+	var status int
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+
+			if attempts == 1 {
+				w.WriteHeader(status)
+			}
+		})
+
+	var m Machine
+
+	if err := m.Setup("mocks/parallel"); err != nil {
+		panic(err)
+	}
+
+	status = http.StatusServiceUnavailable
+	m.Run([]string{"one"})
+
+	if attempts != 2 || len(m.Errors.List) != 0 {
+		t.Errorf("Expected link to succeed on retry, got %v attempts, %v instead", attempts, m.Errors)
+	}
+
+	attempts = 0
+	status = http.StatusForbidden
+	m.Run([]string{"one"})
+
+	if attempts != 1 || len(m.Errors.List) != 1 {
+		t.Errorf("Expected link to fail without retry, got %v attempts, %v instead", attempts, m.Errors)
+	}
+
+	RetryDelay = defaultRetryDelay
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func TestRunCanceled(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+		})
+
+	var m = Machine{
+		Parallel: 1,
+	}
+
+	if err := m.Setup("mocks/parallel"); err != nil {
+		panic(err)
+	}
+
+	m.RunContext(ctx, []string{"one", "two", "three"})
+
+	if !reflect.DeepEqual(m.Linked, []string{"one"}) {
+		t.Errorf("Expected only one to be linked, got %v instead", m.Linked)
+	}
+
+	if len(m.Errors.List) != 2 {
+		t.Errorf("Expected 2 errors, got %v instead", m.Errors)
+	}
+
+	for _, e := range m.Errors.List {
+		if e.Error != context.Canceled {
+			t.Errorf("Expected %v not to be linked as canceled, got %v instead",
+				e.ContainerPath, e.Error)
+		}
+	}
+
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
+
+func TestRunSecrets(t *testing.T) {
+	servertest.Setup()
+	globalconfigmock.Setup()
+
+	var k, _ = secrets.New()
+	var encrypted, _ = k.Encrypt("DB_PASSWORD", "s3cr3t")
+	var dir = copyMockProject("mocks/parallel")
+	defer os.RemoveAll(dir)
+
+	if err := containers.SetEnv(filepath.Join(dir, "one"),
+		map[string]string{"DB_PASSWORD": encrypted}); err != nil {
+		panic(err)
+	}
+
+	if err := os.Setenv(secrets.KeyEnv, secrets.FormatKey(k.Keys[0])); err != nil {
+		panic(err)
+	}
+
+	var sent containers.Container
+
+	servertest.Mux.HandleFunc("/projects",
+		func(w http.ResponseWriter, r *http.Request) {})
+
+	servertest.Mux.HandleFunc("/deploy",
+		func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+				panic(err)
+			}
+		})
+
+	var m Machine
+
+	if err := m.Setup(dir); err != nil {
+		panic(err)
+	}
+
+	m.Run([]string{"one"})
+
+	if len(m.Errors.List) != 0 || sent.Env["DB_PASSWORD"] != "s3cr3t" {
+		t.Errorf("Expected decrypted secret to be sent, got %v, %v instead", sent.Env, m.Errors)
+	}
+
+	if c, err := containers.Read(filepath.Join(dir, "one")); err != nil ||
+		c.Env["DB_PASSWORD"] != encrypted {
+		t.Errorf("Expected container.json to keep the encrypted value, got %v instead", c)
+	}
+
+	if err := os.Unsetenv(secrets.KeyEnv); err != nil {
+		panic(err)
+	}
+
+	globalconfigmock.Teardown()
+	servertest.Teardown()
+}
@@ -0,0 +1,175 @@
+package link
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/wedeploy/cli/apihelper"
+	"github.com/wedeploy/cli/containers"
+	"github.com/wedeploy/cli/projects"
+)
+
+// Plan of the changes linking would make
+type Plan struct {
+	Project       string
+	CreateProject bool
+	UploadAuth    bool
+	Add           []string
+	Update        []string
+	NotLocal      []string
+	Prune         bool
+	Errors        *Errors
+}
+
+// GetPlan reads the local definitions and the current state to plan a link
+func GetPlan(projectPath string, list []string) (*Plan, error) {
+	var project, err = projects.Read(projectPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var plan = &Plan{
+		Project: project.ID,
+		Errors: &Errors{
+			List: []ContainerError{},
+		},
+	}
+
+	if _, err = os.Stat(filepath.Join(projectPath, "auth.json")); err == nil {
+		plan.UploadAuth = true
+	}
+
+	var remote = containers.Containers{}
+
+	switch _, err = projects.Get(project.ID); {
+	case isNotFound(err):
+		plan.CreateProject = true
+	case err != nil:
+		return nil, err
+	default:
+		if remote, err = containers.GetList(project.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var links = []*Link{}
+
+	for _, dir := range list {
+		var l, lerr = New(project, filepath.Join(projectPath, dir))
+
+		if lerr != nil {
+			plan.Errors.List = append(plan.Errors.List, ContainerError{dir, lerr})
+			continue
+		}
+
+		links = append(links, l)
+	}
+
+	if _, err = Waves(links); err != nil {
+		return nil, err
+	}
+
+	for _, l := range links {
+		if _, ok := remote[l.Container.ID]; ok {
+			plan.Update = append(plan.Update, l.Container.ID)
+		} else {
+			plan.Add = append(plan.Add, l.Container.ID)
+		}
+	}
+
+	plan.NotLocal, err = notLocal(projectPath, remote)
+	return plan, err
+}
+
+// notLocal lists the remote containers with no local definition on the project
+func notLocal(projectPath string, remote containers.Containers) ([]string, error) {
+	var local = map[string]bool{}
+	var dirs, err = containers.GetListFromDirectory(projectPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		var c, rerr = containers.Read(filepath.Join(projectPath, dir))
+
+		if rerr != nil {
+			return nil, rerr
+		}
+
+		local[c.ID] = true
+	}
+
+	var list = []string{}
+
+	for id := range remote {
+		if !local[id] {
+			list = append(list, id)
+		}
+	}
+
+	sort.Strings(list)
+	return list, nil
+}
+
+// Orphans lists the remote containers of a project with no local definition
+func Orphans(projectPath, projectID string) ([]string, error) {
+	var remote, err = containers.GetList(projectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return notLocal(projectPath, remote)
+}
+
+func isNotFound(err error) bool {
+	var af, ok = err.(*apihelper.APIFault)
+	return ok && af.Code == http.StatusNotFound
+}
+
+// Print the plan
+func (p *Plan) Print(w io.Writer) {
+	if p.CreateProject {
+		fmt.Fprintf(w, "Project %v will be created.\n", p.Project)
+	}
+
+	if p.UploadAuth {
+		fmt.Fprintf(w, "auth.json will be uploaded to project %v.\n", p.Project)
+	}
+
+	printPlanList(w, "Containers to add:", "+", p.Add)
+	printPlanList(w, "Containers to update:", "~", p.Update)
+
+	if p.Prune {
+		printPlanList(w, "Remote containers not present locally (to unlink):", "-", p.NotLocal)
+	} else {
+		printPlanList(w, "Remote containers not present locally (left untouched):", "!", p.NotLocal)
+	}
+
+	if len(p.Errors.List) != 0 {
+		fmt.Fprintln(w, p.Errors)
+	}
+
+	if !p.CreateProject && !p.UploadAuth && len(p.Add)+len(p.Update) == 0 &&
+		(!p.Prune || len(p.NotLocal) == 0) {
+		fmt.Fprintln(w, "Nothing to link.")
+	}
+}
+
+func printPlanList(w io.Writer, title, mark string, list []string) {
+	if len(list) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, title)
+
+	for _, id := range list {
+		fmt.Fprintf(w, "  %v %v\n", mark, id)
+	}
+}
@@ -0,0 +1,200 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sabhiram/go-git-ignore"
+	"github.com/wedeploy/cli/config"
+	"github.com/wedeploy/cli/containers"
+	"github.com/wedeploy/cli/pod"
+	"github.com/wedeploy/cli/verbose"
+)
+
+var (
+	// PollInterval is how often the containers are scanned for changes
+	PollInterval = time.Second
+
+	// Debounce is how long changes must settle before relinking
+	// It is never shorter than PollInterval, so a burst of changes is relinked once.
+	Debounce = 2 * time.Second
+)
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// tree is the state of the files of a container, by relative path
+type tree map[string]fileState
+
+type watch struct {
+	m       *Machine
+	list    []string
+	trees   map[string]tree
+	pending map[string]bool
+	changed time.Time
+}
+
+// Watch relinks the containers of the list whenever their files change,
+// until the context is canceled.
+// Files ignored when packing a container are ignored.
+func (m *Machine) Watch(ctx context.Context, list []string) error {
+	var w = &watch{
+		m:       m,
+		list:    list,
+		trees:   map[string]tree{},
+		pending: map[string]bool{},
+	}
+
+	w.scan()
+
+	// the first scan is the baseline
+	w.pending = map[string]bool{}
+
+	var debounce = Debounce
+
+	if debounce < PollInterval {
+		debounce = PollInterval
+	}
+
+	var ticker = time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		w.scan()
+
+		if len(w.pending) != 0 && time.Since(w.changed) >= debounce {
+			w.relinkPending(ctx)
+		}
+	}
+}
+
+func (w *watch) scan() {
+	for _, dir := range w.list {
+		var t, err = w.scanContainer(dir)
+
+		if err != nil {
+			verbose.Debug("Can't scan container", dir+":", err)
+			continue
+		}
+
+		if !equalTrees(w.trees[dir], t) {
+			w.pending[dir] = true
+			w.changed = time.Now()
+		}
+
+		w.trees[dir] = t
+	}
+}
+
+func (w *watch) scanContainer(dir string) (tree, error) {
+	var path = filepath.Join(w.m.ProjectPath, dir)
+	var rules, err = ignoreRules(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var t = tree{}
+
+	err = filepath.Walk(path, func(file string, fi os.FileInfo, ierr error) error {
+		if ierr != nil {
+			return ierr
+		}
+
+		var relative, rerr = filepath.Rel(path, file)
+
+		if rerr != nil {
+			return rerr
+		}
+
+		if relative == "." {
+			return nil
+		}
+
+		if rules.MatchesPath(relative) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		t[relative] = fileState{fi.Size(), fi.ModTime(), fi.Mode()}
+		return nil
+	})
+
+	return t, err
+}
+
+func (w *watch) relinkPending(ctx context.Context) {
+	var list = []string{}
+
+	for dir := range w.pending {
+		list = append(list, dir)
+	}
+
+	sort.Strings(list)
+	w.pending = map[string]bool{}
+
+	for _, dir := range list {
+		w.m.logSuccess(fmt.Sprintf("Change detected on %v/, relinking", dir))
+	}
+
+	// relinks are checked and linked in waves, as on RunContext
+	w.m.reset()
+	var links = w.m.read(list)
+
+	for _, l := range links {
+		if err := containers.Unlink(w.m.Project.ID, l.Container.ID); err != nil {
+			verbose.Debug("Unlinking", l.Container.ID, "before relinking failed:", err)
+		}
+	}
+
+	w.m.runLinks(ctx, links)
+}
+
+// ignoreRules gets the rules used when packing the container on a path
+func ignoreRules(path string) (*ignore.GitIgnore, error) {
+	var c, err = containers.Read(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns = append([]string{}, c.DeployIgnore...)
+	patterns = append(patterns, pod.CommonIgnorePatterns...)
+
+	if config.Global != nil {
+		patterns = append(patterns, config.Global.DeployIgnore...)
+	}
+
+	return ignore.CompileIgnoreLines(patterns...)
+}
+
+func equalTrees(a, b tree) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for path, state := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(state.modTime) ||
+			other.size != state.size || other.mode != state.mode {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,15 +1,15 @@
 package projects
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 
 	"github.com/wedeploy/api-go"
 	"github.com/wedeploy/cli/apihelper"
+	"github.com/wedeploy/cli/schema"
 	"github.com/wedeploy/cli/verbose"
 	"github.com/wedeploy/cli/verbosereq"
 )
@@ -38,7 +38,7 @@ var (
 
 // Create a project on WeDeploy
 func Create(filename string) error {
-	var file, err = os.Open(filename)
+	var content, err = schema.ReadFile(filename)
 
 	if err != nil {
 		return err
@@ -49,7 +49,7 @@ func Create(filename string) error {
 
 	var req = apihelper.URL("/projects")
 	apihelper.Auth(req)
-	req.Body(file)
+	req.Body(bytes.NewReader(content))
 
 	return apihelper.Validate(req, req.Post())
 }
@@ -61,17 +61,30 @@ func GetStatus(id string) string {
 	return status
 }
 
+// Get a project
+func Get(id string) (project Project, err error) {
+	err = apihelper.AuthGet("/projects/"+id, &project)
+	return project, err
+}
+
 // List projects
 func List() (list []Project, err error) {
 	err = apihelper.AuthGet("/projects", &list)
 	return list, err
 }
 
-// Read a project directory properties (defined by a project.json on it)
+// Read a project directory properties
+// (defined by a project.json, project.yaml or project.toml on it)
+// The overlay of the current environment is merged over it and its variables interpolated.
 func Read(path string) (*Project, error) {
-	var content, err = ioutil.ReadFile(filepath.Join(path, "project.json"))
+	var file, err = schema.Find(path, "project")
+	var content []byte
 	var data Project
 
+	if err == nil {
+		content, err = schema.ReadFile(file)
+	}
+
 	if err != nil {
 		return nil, readValidate(data, err)
 	}
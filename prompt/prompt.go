@@ -23,6 +23,19 @@ var (
 	errStream io.Writer = os.Stderr
 )
 
+// inReader is shared by all prompts, as a reader might buffer
+// the answers to the next ones, such as on piped input
+var inReader *bufio.Reader
+
+func readLine() string {
+	if inReader == nil {
+		inReader = bufio.NewReader(inStream)
+	}
+
+	var value, _ = inReader.ReadString('\n')
+	return strings.TrimSpace(value)
+}
+
 func isSecretKey(key string) bool {
 	var match, _ = regexp.MatchString(
 		"("+strings.Join(secretKeys, "|")+")",
@@ -45,11 +58,18 @@ func Prompt(param string) string {
 		return string(value)
 	}
 
-	reader := bufio.NewReader(inStream)
 	fmt.Fprintf(outStream, param+": ")
-	var value, _ = reader.ReadString('\n')
+	return readLine()
+}
 
-	value = strings.TrimSpace(value)
+// Confirm asks a yes or no question, defaulting to no.
+func Confirm(question string) bool {
+	fmt.Fprint(outStream, question+" [y/N]: ")
 
-	return value
+	switch strings.ToLower(readLine()) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
 }
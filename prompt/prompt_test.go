@@ -88,3 +88,45 @@ func TestPromptWithSpace(t *testing.T) {
 		t.Error("Unexpected output stream")
 	}
 }
+
+func TestConfirm(t *testing.T) {
+	var cases = map[string]bool{
+		"y\n":   true,
+		"YES\n": true,
+		"n\n":   false,
+		"\n":    false,
+		"":      false,
+	}
+
+	for in, want := range cases {
+		bufInStream.Reset()
+		bufOutStream.Reset()
+		_, _ = bufInStream.WriteString(in)
+
+		if got := Confirm("Continue?"); got != want {
+			t.Errorf("Expected confirmation for %q to be %v, got %v instead", in, want, got)
+		}
+
+		if bufOutStream.String() != "Continue? [y/N]: " {
+			t.Errorf("Unexpected output stream %q", bufOutStream.String())
+		}
+	}
+}
+
+func TestConfirmPiped(t *testing.T) {
+	bufInStream.Reset()
+	bufOutStream.Reset()
+	_, _ = bufInStream.WriteString("y\nvalue\ny\n")
+
+	if !Confirm("First?") {
+		t.Error("Expected first confirmation")
+	}
+
+	if got := Prompt("question"); got != "value" {
+		t.Errorf("Expected prompt value value, got %v instead", got)
+	}
+
+	if !Confirm("Second?") {
+		t.Error("Expected second confirmation, after the answers buffered by the first")
+	}
+}
@@ -0,0 +1,299 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+// Remote to check
+type Remote struct {
+	Name string
+	URL  string
+}
+
+// Credentials used to verify if a remote accepts them
+// They are only sent to remotes on their Endpoint, and never over plain http.
+type Credentials struct {
+	Endpoint string
+	Username string
+	Password string
+	Token    string
+}
+
+// CredentialsStatus tells if a remote accepted the credentials
+type CredentialsStatus int
+
+const (
+	// CredentialsUnknown is used when the credentials could not be verified
+	CredentialsUnknown CredentialsStatus = iota
+
+	// CredentialsValid is used when the remote accepted the credentials
+	CredentialsValid
+
+	// CredentialsInvalid is used when the remote refused the credentials
+	CredentialsInvalid
+)
+
+// Certificate of a remote using TLS
+type Certificate struct {
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+	Valid    bool
+	Err      error
+}
+
+// Result of checking a remote
+type Result struct {
+	Remote
+	Reachable   bool
+	Latency     time.Duration
+	Certificate *Certificate
+	APIVersion  string
+	Credentials CredentialsStatus
+	Err         error
+}
+
+// Checker for remotes
+type Checker struct {
+	Client      *http.Client
+	Credentials Credentials
+}
+
+// ErrInvalidURL is used when a remote URL can't be used
+var ErrInvalidURL = errors.New("Invalid remote URL")
+
+// Timeout for each request made by the default checker
+var Timeout = 10 * time.Second
+
+// ExpiryWarning is how early a certificate is reported as expiring
+var ExpiryWarning = 14 * 24 * time.Hour
+
+// OK tells if the remote passed the check
+func (r Result) OK() bool {
+	return r.Err == nil &&
+		r.Reachable &&
+		(r.Certificate == nil || r.Certificate.Valid) &&
+		r.Credentials != CredentialsInvalid
+}
+
+// ExpiresSoon tells if the certificate of the remote expires soon
+func (c Certificate) ExpiresSoon(now time.Time) bool {
+	return c.Valid && c.NotAfter.Sub(now) < ExpiryWarning
+}
+
+// String representation of the credentials status
+func (c CredentialsStatus) String() string {
+	switch c {
+	case CredentialsValid:
+		return "valid"
+	case CredentialsInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// Check remotes concurrently, returning the results in the same order
+func (c *Checker) Check(remotes []Remote) []Result {
+	var results = make([]Result, len(remotes))
+	var wg sync.WaitGroup
+
+	wg.Add(len(remotes))
+
+	for i, r := range remotes {
+		go func(i int, r Remote) {
+			results[i] = c.CheckRemote(r)
+			wg.Done()
+		}(i, r)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// CheckRemote checks a single remote
+func (c *Checker) CheckRemote(r Remote) Result {
+	var result = Result{
+		Remote: r,
+	}
+
+	var u, err = url.Parse(r.URL)
+
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		result.Err = ErrInvalidURL
+		return result
+	}
+
+	c.checkVersion(&result)
+
+	if result.Reachable && result.Err == nil {
+		c.checkCredentials(&result)
+	}
+
+	return result
+}
+
+func (c *Checker) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+
+	return &http.Client{
+		Timeout: Timeout,
+	}
+}
+
+func (c *Checker) checkVersion(result *Result) {
+	var req, err = http.NewRequest(http.MethodGet, endpoint(result.URL, "version"), nil)
+
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	var start = time.Now()
+	var res *http.Response
+	res, err = c.client().Do(req)
+	result.Latency = time.Since(start)
+
+	if err != nil {
+		verbose.Debug("Error checking remote "+result.Name+":", err)
+
+		if isCertificateError(err) {
+			result.Reachable = true
+			result.Certificate = &Certificate{Err: err}
+		}
+
+		result.Err = err
+		return
+	}
+
+	defer closeBody(res)
+
+	result.Reachable = true
+	result.Certificate = readCertificate(res.TLS)
+
+	if res.StatusCode == http.StatusOK {
+		result.APIVersion = readVersion(res)
+	}
+}
+
+func (c *Checker) checkCredentials(result *Result) {
+	var credentials = c.Credentials
+
+	if credentials.Token == "" && credentials.Username == "" {
+		return
+	}
+
+	if !credentials.belongTo(result.URL) {
+		verbose.Debug("Not sending credentials to remote " + result.Name)
+		return
+	}
+
+	var req, err = http.NewRequest(http.MethodGet, endpoint(result.URL, "projects"), nil)
+
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	if credentials.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+credentials.Token)
+	} else {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+
+	var res *http.Response
+
+	if res, err = c.client().Do(req); err != nil {
+		verbose.Debug("Error checking credentials on remote "+result.Name+":", err)
+		return
+	}
+
+	defer closeBody(res)
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		result.Credentials = CredentialsInvalid
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		result.Credentials = CredentialsValid
+	}
+}
+
+// belongTo tells if the credentials can be sent to a remote URL:
+// it must use https and be on the endpoint of the credentials
+func (c Credentials) belongTo(remoteURL string) bool {
+	var r, err = url.Parse(remoteURL)
+
+	if err != nil || r.Scheme != "https" {
+		return false
+	}
+
+	var e *url.URL
+
+	if e, err = url.Parse(c.Endpoint); err != nil {
+		return false
+	}
+
+	return e.Scheme == r.Scheme &&
+		strings.EqualFold(e.Host, r.Host) &&
+		strings.TrimSuffix(e.Path, "/") == strings.TrimSuffix(r.Path, "/")
+}
+
+func readCertificate(state *tls.ConnectionState) *Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	var cert = state.PeerCertificates[0]
+
+	return &Certificate{
+		Subject:  cert.Subject.CommonName,
+		Issuer:   cert.Issuer.CommonName,
+		NotAfter: cert.NotAfter,
+		Valid:    true,
+	}
+}
+
+func readVersion(res *http.Response) string {
+	var data struct {
+		Version string `json:"version"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		verbose.Debug("Can't read API version:", err)
+		return ""
+	}
+
+	return data.Version
+}
+
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &hostname)
+}
+
+func endpoint(base, path string) string {
+	return strings.TrimSuffix(base, "/") + "/" + path
+}
+
+func closeBody(res *http.Response) {
+	if err := res.Body.Close(); err != nil {
+		verbose.Debug("Error closing response body:", err)
+	}
+}
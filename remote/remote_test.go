@@ -0,0 +1,215 @@
+package remote
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newHandler(user, password string) http.Handler {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"version": "1.2.3"}`)
+	})
+
+	mux.HandleFunc("/projects", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fmt.Fprintf(w, "[]")
+	})
+
+	return mux
+}
+
+func TestCheck(t *testing.T) {
+	var server = httptest.NewTLSServer(newHandler("admin", "safe"))
+	defer server.Close()
+
+	var checker = &Checker{
+		Client: server.Client(),
+		Credentials: Credentials{
+			Endpoint: server.URL,
+			Username: "admin",
+			Password: "safe",
+		},
+	}
+
+	var results = checker.Check([]Remote{
+		{"local", server.URL},
+		{"broken", "not a url"},
+	})
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %v instead", len(results))
+	}
+
+	var r = results[0]
+
+	if !r.OK() || r.Name != "local" {
+		t.Errorf("Expected remote local to pass the check, got %+v instead", r)
+	}
+
+	if r.APIVersion != "1.2.3" {
+		t.Errorf("Expected API version 1.2.3, got %v instead", r.APIVersion)
+	}
+
+	if r.Credentials != CredentialsValid {
+		t.Errorf("Expected credentials to be valid, got %v instead", r.Credentials)
+	}
+
+	if r.Certificate == nil || !r.Certificate.Valid {
+		t.Errorf("Expected valid certificate, got %+v instead", r.Certificate)
+	}
+
+	if r.Latency <= 0 {
+		t.Errorf("Expected latency to be measured")
+	}
+
+	if results[1].OK() || results[1].Err != ErrInvalidURL {
+		t.Errorf("Expected invalid URL error, got %v instead", results[1].Err)
+	}
+}
+
+func TestCheckInvalidCredentials(t *testing.T) {
+	var server = httptest.NewTLSServer(newHandler("admin", "safe"))
+	defer server.Close()
+
+	var checker = &Checker{
+		Client: server.Client(),
+		Credentials: Credentials{
+			Endpoint: server.URL + "/",
+			Username: "admin",
+			Password: "wrong",
+		},
+	}
+
+	var r = checker.CheckRemote(Remote{"local", server.URL})
+
+	if r.OK() || r.Credentials != CredentialsInvalid {
+		t.Errorf("Expected credentials to be invalid, got %v instead", r.Credentials)
+	}
+}
+
+func TestCheckCredentialsNotSent(t *testing.T) {
+	var sent bool
+
+	var handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			sent = true
+		}
+
+		fmt.Fprintf(w, `{"version": "1.2.3"}`)
+	})
+
+	var plain = httptest.NewServer(handler)
+	defer plain.Close()
+
+	var secure = httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	var checker = &Checker{
+		Client: secure.Client(),
+		Credentials: Credentials{
+			Endpoint: plain.URL,
+			Username: "admin",
+			Password: "safe",
+		},
+	}
+
+	// plain http remotes never get the credentials, even on their endpoint
+	var r = checker.CheckRemote(Remote{"plain", plain.URL})
+
+	if !r.OK() || r.Credentials != CredentialsUnknown {
+		t.Errorf("Expected unverified credentials, got %v instead", r.Credentials)
+	}
+
+	// neither do remotes other than the endpoint of the credentials
+	checker.Credentials.Endpoint = "https://api.wedeploy.com"
+	r = checker.CheckRemote(Remote{"other", secure.URL})
+
+	if !r.OK() || r.Credentials != CredentialsUnknown {
+		t.Errorf("Expected unverified credentials, got %v instead", r.Credentials)
+	}
+
+	if sent {
+		t.Errorf("Expected credentials to not be sent")
+	}
+}
+
+func TestCheckWithoutCredentials(t *testing.T) {
+	var server = httptest.NewServer(newHandler("admin", "safe"))
+	defer server.Close()
+
+	var checker = &Checker{}
+	var r = checker.CheckRemote(Remote{"local", server.URL})
+
+	if !r.OK() || r.Credentials != CredentialsUnknown {
+		t.Errorf("Expected unverified credentials, got %v instead", r.Credentials)
+	}
+}
+
+func TestCheckUnreachable(t *testing.T) {
+	var server = httptest.NewServer(newHandler("admin", "safe"))
+	var url = server.URL
+	server.Close()
+
+	var checker = &Checker{}
+	var r = checker.CheckRemote(Remote{"down", url})
+
+	if r.OK() || r.Reachable || r.Err == nil {
+		t.Errorf("Expected remote to be unreachable, got %+v instead", r)
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	var server = httptest.NewTLSServer(newHandler("admin", "safe"))
+	defer server.Close()
+
+	var checker = &Checker{
+		Client: server.Client(),
+	}
+
+	var r = checker.CheckRemote(Remote{"secure", server.URL})
+
+	if !r.OK() {
+		t.Errorf("Expected remote to pass the check, got %v instead", r.Err)
+	}
+
+	if r.Certificate == nil || !r.Certificate.Valid {
+		t.Fatalf("Expected valid certificate, got %+v instead", r.Certificate)
+	}
+
+	if r.Certificate.NotAfter.IsZero() {
+		t.Errorf("Expected certificate expiry date")
+	}
+
+	if r.Certificate.ExpiresSoon(time.Now()) {
+		t.Errorf("Expected certificate to not expire soon")
+	}
+
+	if !r.Certificate.ExpiresSoon(r.Certificate.NotAfter.Add(-time.Hour)) {
+		t.Errorf("Expected certificate to expire soon")
+	}
+}
+
+func TestCheckUntrustedCertificate(t *testing.T) {
+	var server = httptest.NewTLSServer(newHandler("admin", "safe"))
+	defer server.Close()
+
+	var checker = &Checker{}
+	var r = checker.CheckRemote(Remote{"untrusted", server.URL})
+
+	if r.OK() || !r.Reachable {
+		t.Errorf("Expected reachable remote to fail the check")
+	}
+
+	if r.Certificate == nil || r.Certificate.Valid || r.Certificate.Err == nil {
+		t.Errorf("Expected invalid certificate, got %+v instead", r.Certificate)
+	}
+}
@@ -0,0 +1,167 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+// Docker is the interface to the docker daemon used by the run command
+type Docker interface {
+	// ListContainers lists the IDs of the running (or all) containers with a label
+	ListContainers(label string, all bool) ([]string, error)
+
+	// ListImages lists the local images of a repository
+	ListImages(repository string) ([]ImageInfo, error)
+
+	// HasImage tells if an image is available locally
+	HasImage(image string) (bool, error)
+
+	// Pull an image, writing the progress to out
+	Pull(image string, out io.Writer) error
+
+	// Start creates and starts a container, returning its ID
+	Start(options ContainerOptions) (string, error)
+
+	// Stop a container
+	Stop(id string) error
+
+	// Wait blocks until a container stops, returning its exit code
+	Wait(id string) (int, error)
+
+	// RemoveContainer removes a stopped container
+	RemoveContainer(id string) error
+
+	// RemoveVolume removes a named volume, if it exists
+	RemoveVolume(name string) error
+
+	// InspectContainer gets the state of a container
+	InspectContainer(id string) (ContainerInfo, error)
+
+	// InspectImage gets the description of a local image
+	InspectImage(image string) (ImageInfo, error)
+}
+
+// ContainerOptions for starting a container
+type ContainerOptions struct {
+	Image      string
+	Cmd        []string
+	Ports      []PortBinding
+	Binds      []string
+	Env        []string
+	Labels     map[string]string
+	Privileged bool
+	Memory     int64
+	CPUs       float64
+	Network    string
+}
+
+// PortBinding maps a host port to a container port
+type PortBinding struct {
+	Host      string
+	Container string
+	Protocol  string
+}
+
+// DockerError is an error reported by the docker daemon
+type DockerError struct {
+	Code    int
+	Message string
+}
+
+// BackendEnv selects the docker backend ("api" or "exec")
+const BackendEnv = "WEDEPLOY_DOCKER_BACKEND"
+
+func (d DockerError) Error() string {
+	return fmt.Sprintf("docker error %d: %s", d.Code, strings.TrimSpace(d.Message))
+}
+
+// NewDocker gets the docker backend
+// The Engine API is used when the daemon answers it,
+// otherwise the docker binary is used.
+func NewDocker() (Docker, error) {
+	switch backend := os.Getenv(BackendEnv); backend {
+	case "exec":
+		return NewExecDocker()
+	case "api":
+		return NewAPIDocker(os.Getenv("DOCKER_HOST"))
+	case "":
+	default:
+		return nil, fmt.Errorf("Unknown docker backend %q", backend)
+	}
+
+	var api, err = NewAPIDocker(os.Getenv("DOCKER_HOST"))
+
+	if err == nil {
+		if err = api.Ping(); err == nil {
+			return api, nil
+		}
+	}
+
+	verbose.Debug("Docker Engine API not available, using docker binary:", err)
+	return NewExecDocker()
+}
+
+// String representation of a port binding, as used by docker run -p
+func (p PortBinding) String() string {
+	var s = p.Host + ":" + p.Container
+
+	if p.Protocol != "" {
+		s += "/" + p.Protocol
+	}
+
+	return s
+}
+
+// Args gets the equivalent docker run arguments
+func (o ContainerOptions) Args() []string {
+	var args = []string{"run"}
+
+	for _, p := range o.Ports {
+		args = append(args, "-p", p.String())
+	}
+
+	for _, b := range o.Binds {
+		args = append(args, "-v", b)
+	}
+
+	if o.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	if o.Memory != 0 {
+		args = append(args, "--memory", FormatMemory(o.Memory))
+	}
+
+	if o.CPUs != 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(o.CPUs, 'f', -1, 64))
+	}
+
+	if o.Network != "" {
+		args = append(args, "--network", o.Network)
+	}
+
+	for _, e := range o.Env {
+		args = append(args, "-e", e)
+	}
+
+	var labels = []string{}
+
+	for k, v := range o.Labels {
+		labels = append(labels, k+"="+v)
+	}
+
+	sort.Strings(labels)
+
+	for _, l := range labels {
+		args = append(args, "--label", l)
+	}
+
+	args = append(args, "--detach", o.Image)
+	return append(args, o.Cmd...)
+}
@@ -0,0 +1,456 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+// APIVersion of the Docker Engine API
+const APIVersion = "v1.24"
+
+// DefaultDockerHost is the docker daemon address used when DOCKER_HOST is not set
+var DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// PingTimeout is how long to wait for the docker daemon to answer a ping
+var PingTimeout = 5 * time.Second
+
+// APIDocker is the docker backend that speaks the Docker Engine API
+type APIDocker struct {
+	Client *http.Client
+	URL    string
+}
+
+// NewAPIDocker creates a Docker Engine API backend for the daemon at host
+// Hosts are given as in DOCKER_HOST: unix:///path or tcp://host:port.
+// TLS is used when DOCKER_TLS_VERIFY is set, with DOCKER_CERT_PATH certificates.
+func NewAPIDocker(host string) (*APIDocker, error) {
+	if host == "" {
+		host = DefaultDockerHost
+	}
+
+	var u, err = url.Parse(host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "unix":
+		return newUnixAPIDocker(u.Path), nil
+	case "tcp", "http", "https":
+		return newTCPAPIDocker(u.Host)
+	default:
+		return nil, fmt.Errorf("Unsupported docker host %v", host)
+	}
+}
+
+func newUnixAPIDocker(socket string) *APIDocker {
+	var transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &APIDocker{
+		Client: &http.Client{Transport: transport},
+		URL:    "http://docker",
+	}
+}
+
+func newTCPAPIDocker(host string) (*APIDocker, error) {
+	if os.Getenv("DOCKER_TLS_VERIFY") == "" {
+		return &APIDocker{
+			Client: &http.Client{},
+			URL:    "http://" + host,
+		}, nil
+	}
+
+	var config, err = tlsConfig(os.Getenv("DOCKER_CERT_PATH"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIDocker{
+		Client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: config},
+		},
+		URL: "https://" + host,
+	}, nil
+}
+
+func tlsConfig(certPath string) (*tls.Config, error) {
+	var cert, err = tls.LoadX509KeyPair(
+		filepath.Join(certPath, "cert.pem"),
+		filepath.Join(certPath, "key.pem"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ca []byte
+
+	if ca, err = ioutil.ReadFile(filepath.Join(certPath, "ca.pem")); err != nil {
+		return nil, err
+	}
+
+	var pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// Ping the docker daemon
+func (a *APIDocker) Ping() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), PingTimeout)
+	defer cancel()
+
+	var req, err = http.NewRequest("GET", a.URL+"/"+APIVersion+"/_ping", nil)
+
+	if err != nil {
+		return err
+	}
+
+	var res *http.Response
+
+	if res, err = a.Client.Do(req.WithContext(ctx)); err != nil {
+		return err
+	}
+
+	defer closeBody(res)
+
+	if res.StatusCode != http.StatusOK {
+		return apiError(res)
+	}
+
+	return nil
+}
+
+// ListContainers lists the IDs of the running (or all) containers with a label
+func (a *APIDocker) ListContainers(label string, all bool) ([]string, error) {
+	var filters, err = json.Marshal(map[string][]string{
+		"label": {label},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var list []struct {
+		ID string `json:"Id"`
+	}
+
+	var path = "/containers/json?filters=" + url.QueryEscape(string(filters))
+
+	if all {
+		path += "&all=1"
+	}
+
+	if err = a.do("GET", path, nil, &list); err != nil {
+		return nil, err
+	}
+
+	var ids = []string{}
+
+	for _, c := range list {
+		ids = append(ids, c.ID)
+	}
+
+	return ids, nil
+}
+
+// ListImages lists the local images of a repository
+func (a *APIDocker) ListImages(repository string) ([]ImageInfo, error) {
+	var images = []ImageInfo{}
+	var err = a.do("GET", "/images/json?digests=1&filter="+url.QueryEscape(repository),
+		nil, &images)
+	return images, err
+}
+
+// HasImage tells if an image is available locally
+func (a *APIDocker) HasImage(image string) (bool, error) {
+	var err = a.do("GET", "/images/"+image+"/json", nil, nil)
+
+	if de, ok := err.(DockerError); ok && de.Code == http.StatusNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Pull an image, writing the progress to out
+func (a *APIDocker) Pull(image string, out io.Writer) error {
+	var name, tag = splitImageTag(image)
+	var res, err = a.request("POST", "/images/create?fromImage="+url.QueryEscape(name)+
+		"&tag="+url.QueryEscape(tag), nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeBody(res)
+
+	// progress is streamed as a sequence of JSON messages
+	var decoder = json.NewDecoder(res.Body)
+
+	for {
+		var m struct {
+			Status   string `json:"status"`
+			ID       string `json:"id"`
+			Progress string `json:"progress"`
+			Error    string `json:"error"`
+		}
+
+		switch err = decoder.Decode(&m); {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case m.Error != "":
+			return DockerError{http.StatusInternalServerError, m.Error}
+		case m.ID != "":
+			fmt.Fprintf(out, "%s: %s %s\n", m.ID, m.Status, m.Progress)
+		default:
+			fmt.Fprintln(out, m.Status)
+		}
+	}
+}
+
+// Start creates and starts a container, returning its ID
+func (a *APIDocker) Start(options ContainerOptions) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	if err := a.do("POST", "/containers/create", createBody(options), &created); err != nil {
+		return "", err
+	}
+
+	return created.ID, a.do("POST", "/containers/"+created.ID+"/start", nil, nil)
+}
+
+// Stop a container
+func (a *APIDocker) Stop(id string) error {
+	var err = a.do("POST", "/containers/"+id+"/stop", nil, nil)
+
+	// 304: container already stopped
+	if de, ok := err.(DockerError); ok && de.Code == http.StatusNotModified {
+		return nil
+	}
+
+	return err
+}
+
+// Wait blocks until a container stops, returning its exit code
+func (a *APIDocker) Wait(id string) (int, error) {
+	var status struct {
+		StatusCode int
+	}
+
+	var err = a.do("POST", "/containers/"+id+"/wait", nil, &status)
+	return status.StatusCode, err
+}
+
+// RemoveContainer removes a stopped container
+func (a *APIDocker) RemoveContainer(id string) error {
+	return a.do("DELETE", "/containers/"+id, nil, nil)
+}
+
+// RemoveVolume removes a named volume, if it exists
+func (a *APIDocker) RemoveVolume(name string) error {
+	var err = a.do("DELETE", "/volumes/"+name, nil, nil)
+
+	if de, ok := err.(DockerError); ok && de.Code == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// InspectContainer gets the state of a container
+func (a *APIDocker) InspectContainer(id string) (ContainerInfo, error) {
+	var c containerJSON
+	var err = notFound(a.do("GET", "/containers/"+id+"/json", nil, &c))
+	return c.info(), err
+}
+
+// InspectImage gets the description of a local image
+func (a *APIDocker) InspectImage(image string) (ImageInfo, error) {
+	var i ImageInfo
+	var err = notFound(a.do("GET", "/images/"+image+"/json", nil, &i))
+	return i, err
+}
+
+func notFound(err error) error {
+	if de, ok := err.(DockerError); ok && de.Code == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+type hostConfig struct {
+	Binds        []string                 `json:",omitempty"`
+	PortBindings map[string][]portBinding `json:",omitempty"`
+	Privileged   bool
+	Memory       int64  `json:",omitempty"`
+	CPUPeriod    int64  `json:"CpuPeriod,omitempty"`
+	CPUQuota     int64  `json:"CpuQuota,omitempty"`
+	NetworkMode  string `json:",omitempty"`
+}
+
+// cpuPeriod is the CFS period used to limit the CPUs (NanoCPUs requires API v1.25)
+const cpuPeriod = 100000
+
+type portBinding struct {
+	HostPort string
+}
+
+type createContainer struct {
+	Image        string
+	Cmd          []string            `json:",omitempty"`
+	Labels       map[string]string   `json:",omitempty"`
+	Env          []string            `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	HostConfig   hostConfig
+}
+
+func createBody(options ContainerOptions) createContainer {
+	var body = createContainer{
+		Image:        options.Image,
+		Cmd:          options.Cmd,
+		Labels:       options.Labels,
+		Env:          options.Env,
+		ExposedPorts: map[string]struct{}{},
+		HostConfig: hostConfig{
+			Binds:        options.Binds,
+			PortBindings: map[string][]portBinding{},
+			Privileged:   options.Privileged,
+			Memory:       options.Memory,
+			NetworkMode:  options.Network,
+		},
+	}
+
+	if options.CPUs != 0 {
+		body.HostConfig.CPUPeriod = cpuPeriod
+		body.HostConfig.CPUQuota = int64(options.CPUs * cpuPeriod)
+	}
+
+	for _, p := range options.Ports {
+		var port = p.Container + "/" + p.protocol()
+		body.ExposedPorts[port] = struct{}{}
+		body.HostConfig.PortBindings[port] = append(
+			body.HostConfig.PortBindings[port],
+			portBinding{p.Host})
+	}
+
+	return body
+}
+
+func (a *APIDocker) do(method, path string, body, data interface{}) error {
+	var res, err = a.request(method, path, body)
+
+	if err != nil {
+		return err
+	}
+
+	defer closeBody(res)
+
+	if data == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(data)
+}
+
+func (a *APIDocker) request(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+
+	if body != nil {
+		var b, err = json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(b)
+	}
+
+	var req, err = http.NewRequest(method, a.URL+"/"+APIVersion+path, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	verbose.Debug(">", method, req.URL)
+
+	var res *http.Response
+
+	if res, err = a.Client.Do(req); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer closeBody(res)
+	return nil, apiError(res)
+}
+
+func apiError(res *http.Response) error {
+	var content, _ = ioutil.ReadAll(res.Body)
+	var fault struct {
+		Message string `json:"message"`
+	}
+
+	if err := json.Unmarshal(content, &fault); err != nil || fault.Message == "" {
+		fault.Message = string(content)
+	}
+
+	if fault.Message == "" {
+		fault.Message = res.Status
+	}
+
+	return DockerError{res.StatusCode, fault.Message}
+}
+
+func splitImageTag(image string) (name, tag string) {
+	var slash = strings.LastIndex(image, "/")
+	var colon = strings.LastIndex(image, ":")
+
+	if colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+
+	return image, "latest"
+}
+
+func closeBody(res *http.Response) {
+	if err := res.Body.Close(); err != nil {
+		verbose.Debug("Error closing response body:", err)
+	}
+}
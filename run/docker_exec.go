@@ -0,0 +1,201 @@
+package run
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+// ExecDocker is the docker backend that runs the docker binary
+type ExecDocker struct {
+	path string
+}
+
+// NewExecDocker creates a docker backend that runs the docker binary
+func NewExecDocker() (*ExecDocker, error) {
+	var path, err = exec.LookPath(bin)
+
+	if err != nil {
+		return nil, ErrDockerNotFound
+	}
+
+	return &ExecDocker{path}, nil
+}
+
+// ListContainers lists the IDs of the running (or all) containers with a label
+func (e *ExecDocker) ListContainers(label string, all bool) ([]string, error) {
+	var args = []string{"ps", "--filter", "label=" + label, "--format", "{{.ID}}"}
+
+	if all {
+		args = append(args, "--all")
+	}
+
+	var out, err = e.output(args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(out), nil
+}
+
+// ListImages lists the local images of a repository
+func (e *ExecDocker) ListImages(repository string) ([]ImageInfo, error) {
+	var out, err = e.output("images", "--digests", "--no-trunc", "--format",
+		"{{.ID}}\t{{.Repository}}:{{.Tag}}\t{{.Repository}}@{{.Digest}}", repository)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var images = []ImageInfo{}
+	var index = map[string]int{}
+
+	for _, line := range strings.Split(out, "\n") {
+		var fields = strings.Split(line, "\t")
+
+		if len(fields) != 3 {
+			continue
+		}
+
+		var i, ok = index[fields[0]]
+
+		if !ok {
+			i = len(images)
+			index[fields[0]] = i
+			images = append(images, ImageInfo{ID: fields[0]})
+		}
+
+		if !strings.HasSuffix(fields[1], ":<none>") {
+			images[i].RepoTags = append(images[i].RepoTags, fields[1])
+		}
+
+		if !strings.HasSuffix(fields[2], "@<none>") {
+			images[i].RepoDigests = append(images[i].RepoDigests, fields[2])
+		}
+	}
+
+	return images, nil
+}
+
+// HasImage tells if an image is available locally
+func (e *ExecDocker) HasImage(image string) (bool, error) {
+	var docker = exec.Command(e.path, "inspect", "--type", "image", image)
+
+	if err := docker.Run(); err != nil {
+		verbose.Debug("docker inspect error:", err.Error())
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Pull an image, writing the progress to out
+func (e *ExecDocker) Pull(image string, out io.Writer) error {
+	var docker = exec.Command(e.path, "pull", image)
+	var stderr bytes.Buffer
+	docker.Stderr = &stderr
+	docker.Stdout = out
+
+	return commandError(docker.Run(), stderr)
+}
+
+// Start creates and starts a container, returning its ID
+func (e *ExecDocker) Start(options ContainerOptions) (string, error) {
+	return e.output(options.Args()...)
+}
+
+// Stop a container
+func (e *ExecDocker) Stop(id string) error {
+	var _, err = e.output("stop", id)
+	return err
+}
+
+// Wait blocks until a container stops, returning its exit code
+func (e *ExecDocker) Wait(id string) (int, error) {
+	var docker = exec.Command(e.path, "wait", id)
+
+	// keep Ctrl+C from killing docker wait before the container is stopped
+	detachProcessGroup(docker)
+
+	var out, err = runDocker(docker)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(out)
+}
+
+// RemoveContainer removes a stopped container
+func (e *ExecDocker) RemoveContainer(id string) error {
+	var _, err = e.output("rm", id)
+	return err
+}
+
+// RemoveVolume removes a named volume, if it exists
+func (e *ExecDocker) RemoveVolume(name string) error {
+	var _, err = e.output("volume", "rm", name)
+
+	if de, ok := err.(DockerError); ok && strings.Contains(de.Message, "No such volume") {
+		return nil
+	}
+
+	return err
+}
+
+// InspectContainer gets the state of a container
+func (e *ExecDocker) InspectContainer(id string) (ContainerInfo, error) {
+	var c containerJSON
+	var err = e.inspect("container", id, &c)
+	return c.info(), err
+}
+
+// InspectImage gets the description of a local image
+func (e *ExecDocker) InspectImage(image string) (ImageInfo, error) {
+	var i ImageInfo
+	var err = e.inspect("image", image, &i)
+	return i, err
+}
+
+func (e *ExecDocker) inspect(kind, name string, data interface{}) error {
+	var out, err = e.output("inspect", "--type", kind, name)
+
+	if de, ok := err.(DockerError); ok && strings.Contains(de.Message, "No such") {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return decodeInspect(out, data)
+}
+
+func (e *ExecDocker) output(args ...string) (string, error) {
+	return runDocker(exec.Command(e.path, args...))
+}
+
+func runDocker(docker *exec.Cmd) (string, error) {
+	var stdout, stderr bytes.Buffer
+	docker.Stdout = &stdout
+	docker.Stderr = &stderr
+
+	if err := commandError(docker.Run(), stderr); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func commandError(err error, stderr bytes.Buffer) error {
+	if ee, ok := err.(*exec.ExitError); ok && stderr.Len() != 0 {
+		return DockerError{ee.ExitCode(), stderr.String()}
+	}
+
+	return err
+}
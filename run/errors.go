@@ -0,0 +1,53 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrAlreadyRunning is used when the infrastructure is running and it shouldn't be
+	ErrAlreadyRunning = errors.New("WeDeploy is already running")
+
+	// ErrNotRunning is used when the infrastructure is expected to be running
+	ErrNotRunning = errors.New("WeDeploy is not running")
+
+	// ErrDockerNotFound is used when the docker binary is not installed
+	ErrDockerNotFound = errors.New("Docker is not installed")
+)
+
+// PullError is used when the infrastructure image can't be pulled
+type PullError struct {
+	Image string
+	Err   error
+}
+
+// StopError is used when the infrastructure container can't be stopped
+type StopError struct {
+	Container string
+	Err       error
+}
+
+// PortConflictsError is used when host ports needed by the infrastructure are in use
+type PortConflictsError struct {
+	Conflicts []PortConflict
+}
+
+func (p PullError) Error() string {
+	return fmt.Sprintf("Can't pull image %v: %v", p.Image, p.Err)
+}
+
+func (s StopError) Error() string {
+	return fmt.Sprintf("Can't stop container %v: %v", s.Container, s.Err)
+}
+
+func (p PortConflictsError) Error() string {
+	var lines = []string{"WeDeploy can't use the following host ports:"}
+
+	for _, c := range p.Conflicts {
+		lines = append(lines, "  "+c.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,239 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// HostIP is the address of the host given to the infrastructure as WEDEPLOY_HOST_IP
+type HostIP struct {
+	IP        net.IP
+	Interface string
+	Reason    string
+}
+
+// ErrInvalidHostIP is used when the host IP override is not an IP address
+var ErrInvalidHostIP = errors.New("Invalid host IP address")
+
+// virtualInterfaces are prefixes of the names of interfaces that don't
+// reach the host from the infrastructure: bridges, tunnels and VM networks
+var virtualInterfaces = []string{
+	"docker",
+	"br-",
+	"veth",
+	"virbr",
+	"vboxnet",
+	"vmnet",
+	"tun",
+	"tap",
+	"utun",
+	"wg",
+	"ppp",
+	"ipsec",
+	"zt",
+	"awdl",
+	"llw",
+	"bridge",
+}
+
+// routeProbes are addresses reserved for documentation (RFC 5737 and RFC 3849)
+// used to ask the system which local address the default route uses.
+// Connecting an UDP socket sends no packets.
+var routeProbes = []string{
+	"198.51.100.1:80",
+	"[2001:db8::1]:80",
+}
+
+type hostInterface struct {
+	Name  string
+	Flags net.Flags
+	IPs   []net.IP
+}
+
+// listInterfaces lists the network interfaces; replaced on tests
+var listInterfaces = func() ([]hostInterface, error) {
+	var ifaces, err = net.Interfaces()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var list = []hostInterface{}
+
+	for _, i := range ifaces {
+		var addrs, aerr = i.Addrs()
+
+		if aerr != nil {
+			return nil, aerr
+		}
+
+		var hi = hostInterface{
+			Name:  i.Name,
+			Flags: i.Flags,
+		}
+
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				hi.IPs = append(hi.IPs, ipnet.IP)
+			}
+		}
+
+		list = append(list, hi)
+	}
+
+	return list, nil
+}
+
+// routeSource gets the local address used to reach an address; replaced on tests
+var routeSource = func(address string) (net.IP, error) {
+	var conn, err = net.Dial("udp", address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+func (h HostIP) String() string {
+	if h.Interface == "" {
+		return fmt.Sprintf("%v (%v)", h.IP, h.Reason)
+	}
+
+	return fmt.Sprintf("%v on %v (%v)", h.IP, h.Interface, h.Reason)
+}
+
+// DetectHostIP finds the address of the host
+// An override (from --host-ip or the configuration) is used as is.
+// Otherwise the address of the default route is used, IPv4 first,
+// unless it is on a virtual interface, in which case the first
+// address of a physical interface is used.
+func DetectHostIP(override string) (HostIP, error) {
+	if override != "" {
+		var ip = net.ParseIP(override)
+
+		if ip == nil {
+			return HostIP{}, ErrInvalidHostIP
+		}
+
+		return HostIP{
+			IP:     ip,
+			Reason: "set by --host-ip or the host_ip configuration key",
+		}, nil
+	}
+
+	var ifaces, err = listInterfaces()
+
+	if err != nil {
+		return HostIP{}, err
+	}
+
+	var skipped = []string{}
+
+	for _, probe := range routeProbes {
+		var ip, rerr = routeSource(probe)
+
+		if rerr != nil {
+			continue
+		}
+
+		var iface, ok = findInterface(ifaces, ip)
+
+		switch {
+		case !ok:
+			continue
+		case isVirtualInterface(iface.Name):
+			skipped = append(skipped, iface.Name)
+		default:
+			return HostIP{
+				IP:        ip,
+				Interface: iface.Name,
+				Reason:    "interface of the default route",
+			}, nil
+		}
+	}
+
+	var reason = "no default route"
+
+	if len(skipped) != 0 {
+		reason = "default route is on virtual interface " + strings.Join(skipped, ", ")
+	}
+
+	return firstPhysicalAddress(ifaces, reason)
+}
+
+// GetWeDeployHost gets the WeDeploy infrastructure host
+func GetWeDeployHost() (string, error) {
+	var host, err = DetectHostIP("")
+
+	if err != nil {
+		return "", err
+	}
+
+	return host.IP.String(), nil
+}
+
+func findInterface(ifaces []hostInterface, ip net.IP) (hostInterface, bool) {
+	for _, i := range ifaces {
+		for _, a := range i.IPs {
+			if a.Equal(ip) {
+				return i, true
+			}
+		}
+	}
+
+	return hostInterface{}, false
+}
+
+func isVirtualInterface(name string) bool {
+	for _, prefix := range virtualInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func firstPhysicalAddress(ifaces []hostInterface, reason string) (HostIP, error) {
+	var candidate *HostIP
+
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 ||
+			isVirtualInterface(i.Name) {
+			continue
+		}
+
+		for _, ip := range i.IPs {
+			if !ip.IsGlobalUnicast() {
+				continue
+			}
+
+			var h = HostIP{
+				IP:        ip,
+				Interface: i.Name,
+				Reason:    "first address of a physical interface; " + reason,
+			}
+
+			if ip.To4() != nil {
+				return h, nil
+			}
+
+			if candidate == nil {
+				candidate = &h
+			}
+		}
+	}
+
+	if candidate == nil {
+		return HostIP{}, ErrHostNotFound
+	}
+
+	return *candidate, nil
+}
@@ -0,0 +1,109 @@
+package run
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/wedeploy/cli/defaults"
+)
+
+// ImageRepository is the docker repository of the infrastructure image
+const ImageRepository = "wedeploy/local"
+
+// Pin of the infrastructure image: a tag, optionally with the expected digest
+type Pin struct {
+	Tag    string
+	Digest string
+}
+
+// ErrInvalidPin is used when an image pin can't be parsed
+var ErrInvalidPin = errors.New(
+	"Invalid image: use a tag, optionally followed by @digest (such as 1.0@sha256:...)")
+
+var (
+	tagRegex    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestRegex = regexp.MustCompile(`^[a-z0-9]+:[a-f0-9]{32,}$`)
+)
+
+// ParsePin parses an image pin in the tag[@digest] format
+// The default tag is used for an empty pin.
+func ParsePin(s string) (Pin, error) {
+	var pin = Pin{
+		Tag: defaults.WeDeployImageTag,
+	}
+
+	if s == "" {
+		return pin, nil
+	}
+
+	var parts = strings.SplitN(s, "@", 2)
+
+	if parts[0] != "" {
+		pin.Tag = parts[0]
+	}
+
+	if len(parts) == 2 {
+		pin.Digest = parts[1]
+	}
+
+	if !tagRegex.MatchString(pin.Tag) ||
+		(len(parts) == 2 && !digestRegex.MatchString(pin.Digest)) {
+		return pin, ErrInvalidPin
+	}
+
+	return pin, nil
+}
+
+// Image gets the docker image of the pin
+func (p Pin) Image() string {
+	return ImageRepository + ":" + p.Tag
+}
+
+func (p Pin) String() string {
+	if p.Digest == "" {
+		return p.Tag
+	}
+
+	return p.Tag + "@" + p.Digest
+}
+
+// CheckDigest compares the digest of the local image with the pinned one
+// It returns the local digest and whether it matches (always true with no digest pinned).
+func CheckDigest(docker Docker, pin Pin) (string, bool, error) {
+	var image, err = docker.InspectImage(pin.Image())
+
+	if err != nil {
+		return "", false, err
+	}
+
+	var digest = image.Digest()
+	return digest, pin.Digest == "" || pin.Digest == digest, nil
+}
+
+// ListImages lists the local infrastructure images
+func ListImages(docker Docker) ([]ImageInfo, error) {
+	return docker.ListImages(ImageRepository)
+}
+
+// Upgrade pulls the image of the pin, telling if the local image changed
+func Upgrade(docker Docker, pin Pin, out io.Writer) (bool, error) {
+	var before, err = docker.InspectImage(pin.Image())
+
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+
+	if err = docker.Pull(pin.Image(), out); err != nil {
+		return false, err
+	}
+
+	var after ImageInfo
+
+	if after, err = docker.InspectImage(pin.Image()); err != nil {
+		return false, err
+	}
+
+	return before.ID != after.ID, nil
+}
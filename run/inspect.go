@@ -0,0 +1,113 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContainerInfo is the state of a container
+type ContainerInfo struct {
+	ID        string
+	Image     string
+	ImageID   string
+	Running   bool
+	StartedAt time.Time
+	Health    string
+	Ports     []PortBinding
+}
+
+// ImageInfo is the description of a local image
+type ImageInfo struct {
+	ID          string
+	RepoTags    []string
+	RepoDigests []string
+}
+
+// ErrNotFound is used when a container or image doesn't exist
+var ErrNotFound = errors.New("Not found")
+
+// containerJSON is the inspect representation of a container,
+// shared by the Engine API and docker inspect
+type containerJSON struct {
+	ID     string `json:"Id"`
+	Image  string
+	Config struct {
+		Image string
+	}
+	State struct {
+		Running   bool
+		StartedAt time.Time
+		Health    *struct {
+			Status string
+		}
+	}
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string
+		}
+	}
+}
+
+func (c containerJSON) info() ContainerInfo {
+	var info = ContainerInfo{
+		ID:        c.ID,
+		Image:     c.Config.Image,
+		ImageID:   c.Image,
+		Running:   c.State.Running,
+		StartedAt: c.State.StartedAt,
+		Ports:     []PortBinding{},
+	}
+
+	if c.State.Health != nil {
+		info.Health = c.State.Health.Status
+	}
+
+	for port, bindings := range c.NetworkSettings.Ports {
+		var parts = strings.SplitN(port, "/", 2)
+		var protocol = ""
+
+		if len(parts) == 2 && parts[1] != "tcp" {
+			protocol = parts[1]
+		}
+
+		for _, b := range bindings {
+			info.Ports = append(info.Ports, PortBinding{b.HostPort, parts[0], protocol})
+		}
+	}
+
+	sort.Slice(info.Ports, func(i, j int) bool {
+		return info.Ports[i].String() < info.Ports[j].String()
+	})
+
+	return info
+}
+
+// Digest gets the digest of the image (from the first repository digest)
+func (i ImageInfo) Digest() string {
+	for _, d := range i.RepoDigests {
+		if n := strings.Index(d, "@"); n != -1 {
+			return d[n+1:]
+		}
+	}
+
+	return ""
+}
+
+// decodeInspect decodes docker inspect output, which is a list
+func decodeInspect(out string, data interface{}) error {
+	var list []json.RawMessage
+
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(list[0], data)
+}
@@ -0,0 +1,174 @@
+package run
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortConflict is a host port already in use
+type PortConflict struct {
+	Port    PortBinding
+	Process string
+}
+
+// InvalidPortError is used when a port mapping can't be parsed
+type InvalidPortError struct {
+	Mapping string
+}
+
+var defaultPorts = []PortBinding{
+	{"24224", "24224", "tcp"},
+	{"24224", "24224", "udp"},
+	{"80", "80", ""},
+	{"5001", "5001", ""},
+	{"5005", "5005", ""},
+	{"8001", "8001", ""},
+	{"8080", "8080", ""},
+	{"8500", "8500", ""},
+	{"9200", "9200", ""},
+}
+
+// APIPort is the container port of the WeDeploy API
+const APIPort = "8080"
+
+func (i InvalidPortError) Error() string {
+	return fmt.Sprintf(`Invalid port mapping %q: use host:container, such as "8081:80"`,
+		i.Mapping)
+}
+
+func (p PortConflict) String() string {
+	var s = fmt.Sprintf("port %v/%v is already in use", p.Port.Host, p.Port.protocol())
+
+	if p.Process != "" {
+		s += " by " + p.Process
+	}
+
+	return s
+}
+
+// Ports gets the port bindings of the infrastructure, remapped
+// by a list of host:container[/protocol] mappings (later mappings win)
+func Ports(mappings []string) ([]PortBinding, error) {
+	var ports = make([]PortBinding, len(defaultPorts))
+	copy(ports, defaultPorts)
+
+	for _, m := range mappings {
+		var remap, err = parsePort(m)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ports = remapPort(ports, remap)
+	}
+
+	return ports, nil
+}
+
+// LocalEndpoint gets the endpoint of the API for the given port bindings
+func LocalEndpoint(ports []PortBinding) string {
+	var port = APIPort
+
+	for _, p := range ports {
+		if p.Container == APIPort && p.protocol() == "tcp" {
+			port = p.Host
+		}
+	}
+
+	return "http://localhost:" + port + "/"
+}
+
+// CheckPorts finds which host ports are already in use
+func CheckPorts(ports []PortBinding) []PortConflict {
+	var conflicts = []PortConflict{}
+
+	for _, p := range ports {
+		if !portInUse(p) {
+			continue
+		}
+
+		conflicts = append(conflicts, PortConflict{
+			Port:    p,
+			Process: portOwner(p),
+		})
+	}
+
+	return conflicts
+}
+
+func portInUse(p PortBinding) bool {
+	var address = ":" + p.Host
+
+	if p.protocol() == "udp" {
+		var conn, err = net.ListenPacket("udp", address)
+
+		if err == nil {
+			_ = conn.Close()
+		}
+
+		return isAddrInUse(err)
+	}
+
+	var l, err = net.Listen("tcp", address)
+
+	if err == nil {
+		_ = l.Close()
+	}
+
+	// other errors (such as no permission to bind to a privileged port)
+	// are not conflicts: the docker daemon binds the ports, not us
+	return isAddrInUse(err)
+}
+
+func parsePort(mapping string) (PortBinding, error) {
+	var p PortBinding
+	var m = strings.TrimSpace(mapping)
+
+	if i := strings.Index(m, "/"); i != -1 {
+		p.Protocol = m[i+1:]
+		m = m[:i]
+	}
+
+	var parts = strings.Split(m, ":")
+
+	if len(parts) != 2 || !validPort(parts[0]) || !validPort(parts[1]) ||
+		(p.Protocol != "" && p.Protocol != "tcp" && p.Protocol != "udp") {
+		return p, InvalidPortError{mapping}
+	}
+
+	p.Host, p.Container = parts[0], parts[1]
+	return p, nil
+}
+
+func validPort(port string) bool {
+	var n, err = strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func remapPort(ports []PortBinding, remap PortBinding) []PortBinding {
+	var found = false
+
+	for i, p := range ports {
+		if p.Container == remap.Container &&
+			(remap.Protocol == "" || remap.protocol() == p.protocol()) {
+			ports[i].Host = remap.Host
+			found = true
+		}
+	}
+
+	if !found {
+		ports = append(ports, remap)
+	}
+
+	return ports
+}
+
+func (p PortBinding) protocol() string {
+	if p.Protocol == "" {
+		return "tcp"
+	}
+
+	return p.Protocol
+}
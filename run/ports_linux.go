@@ -0,0 +1,89 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// portOwner finds the process using a port through /proc
+// Only processes of the current user can be found without privileges.
+func portOwner(p PortBinding) string {
+	var inodes = socketInodes(p)
+
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	var fds, _ = filepath.Glob("/proc/[0-9]*/fd/*")
+
+	for _, fd := range fds {
+		var link, err = os.Readlink(fd)
+
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+
+		if inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+			return processName(strings.Split(fd, "/")[2])
+		}
+	}
+
+	return ""
+}
+
+func socketInodes(p PortBinding) map[string]bool {
+	var inodes = map[string]bool{}
+	var port, err = strconv.Atoi(p.Host)
+
+	if err != nil {
+		return inodes
+	}
+
+	var local = fmt.Sprintf(":%04X", port)
+	var protocol = p.protocol()
+
+	for _, table := range []string{protocol, protocol + "6"} {
+		var file, err = os.Open(filepath.Join("/proc/net", table))
+
+		if err != nil {
+			continue
+		}
+
+		var scanner = bufio.NewScanner(file)
+
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			var fields = strings.Fields(scanner.Text())
+
+			if len(fields) < 10 || !strings.HasSuffix(fields[1], local) {
+				continue
+			}
+
+			// only listening TCP sockets (state 0A) own the port
+			if protocol == "tcp" && fields[3] != "0A" {
+				continue
+			}
+
+			inodes[fields[9]] = true
+		}
+
+		_ = file.Close()
+	}
+
+	return inodes
+}
+
+func processName(pid string) string {
+	var comm, err = ioutil.ReadFile(filepath.Join("/proc", pid, "comm"))
+
+	if err != nil {
+		return "process " + pid
+	}
+
+	return fmt.Sprintf("%s (pid %s)", strings.TrimSpace(string(comm)), pid)
+}
@@ -0,0 +1,45 @@
+// +build !linux
+
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// portOwner finds the process using a port with lsof, where available
+func portOwner(p PortBinding) string {
+	var args = []string{"-nP", "-F", "pc", "-i", p.protocol() + ":" + p.Host}
+
+	if p.protocol() == "tcp" {
+		args = append(args, "-sTCP:LISTEN")
+	}
+
+	var lsof = exec.Command("lsof", args...)
+	var buf bytes.Buffer
+	lsof.Stdout = &buf
+
+	if err := lsof.Run(); err != nil {
+		return ""
+	}
+
+	// lsof -F output has one field per line, prefixed by its name
+	var pid, command string
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p") && pid == "":
+			pid = line[1:]
+		case strings.HasPrefix(line, "c") && command == "":
+			command = line[1:]
+		}
+	}
+
+	if pid == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s (pid %s)", command, pid)
+}
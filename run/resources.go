@@ -0,0 +1,155 @@
+package run
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resources of the infrastructure container: limits and extra docker options
+type Resources struct {
+	Memory  int64
+	CPUs    float64
+	Env     []string
+	Volumes []string
+	Network string
+}
+
+// InvalidOptionError is used when a run option can't be parsed
+type InvalidOptionError struct {
+	Option string
+	Value  string
+	Usage  string
+}
+
+var memoryUnits = map[byte]int64{
+	'b': 1,
+	'k': 1 << 10,
+	'm': 1 << 20,
+	'g': 1 << 30,
+}
+
+// minMemory is the minimum memory limit accepted by docker
+const minMemory = 4 << 20
+
+func (i InvalidOptionError) Error() string {
+	return fmt.Sprintf("Invalid %v %q: %v", i.Option, i.Value, i.Usage)
+}
+
+// ParseResources parses the resources options, as given by flags or configuration
+func ParseResources(memory, cpus string, env, volumes []string, network string) (Resources, error) {
+	var r = Resources{
+		Env:     env,
+		Volumes: volumes,
+		Network: network,
+	}
+
+	var err error
+
+	if r.Memory, err = ParseMemory(memory); err != nil {
+		return r, err
+	}
+
+	if r.CPUs, err = parseCPUs(cpus); err != nil {
+		return r, err
+	}
+
+	for _, e := range env {
+		if strings.HasPrefix(e, "=") || strings.TrimSpace(e) == "" {
+			return r, InvalidOptionError{"environment variable", e, "use NAME=value"}
+		}
+	}
+
+	for _, v := range volumes {
+		if err = checkVolume(v); err != nil {
+			return r, err
+		}
+	}
+
+	if strings.ContainsAny(network, " \t/") {
+		return r, InvalidOptionError{"network", network, "use the name of a docker network"}
+	}
+
+	return r, nil
+}
+
+// ParseMemory parses a memory limit such as 512m or 2g (0 if empty)
+func ParseMemory(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var invalid = InvalidOptionError{"memory limit", s,
+		"use a number with an optional b, k, m or g unit (at least 4m), such as 2g"}
+
+	var number = strings.ToLower(s)
+	var unit = int64(1)
+
+	if u, ok := memoryUnits[number[len(number)-1]]; ok {
+		unit = u
+		number = number[:len(number)-1]
+	}
+
+	var n, err = strconv.ParseInt(number, 10, 64)
+
+	if err != nil || n*unit < minMemory {
+		return 0, invalid
+	}
+
+	return n * unit, nil
+}
+
+// FormatMemory formats a memory limit with the largest exact unit
+func FormatMemory(bytes int64) string {
+	for _, u := range []byte{'g', 'm', 'k'} {
+		if bytes%memoryUnits[u] == 0 {
+			return strconv.FormatInt(bytes/memoryUnits[u], 10) + string(u)
+		}
+	}
+
+	return strconv.FormatInt(bytes, 10)
+}
+
+func parseCPUs(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var cpus, err = strconv.ParseFloat(s, 64)
+
+	if err != nil || cpus <= 0 {
+		return 0, InvalidOptionError{"number of CPUs", s, "use a positive number, such as 1.5"}
+	}
+
+	return cpus, nil
+}
+
+func checkVolume(v string) error {
+	var parts = strings.Split(v, ":")
+	var invalid = InvalidOptionError{"volume", v,
+		"use host:container[:ro], such as /home/me/data:/data:ro"}
+
+	// the host path may have a drive letter, such as C:\data
+	if len(parts) > 2 && len(parts[0]) == 1 {
+		parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+	}
+
+	switch {
+	case len(parts) < 2 || len(parts) > 3:
+		return invalid
+	case parts[0] == "" || !strings.HasPrefix(parts[1], "/"):
+		return invalid
+	case len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw":
+		return invalid
+	}
+
+	return nil
+}
+
+func (r Resources) apply(options *ContainerOptions) {
+	options.Memory = r.Memory
+	options.CPUs = r.CPUs
+	options.Network = r.Network
+	options.Env = append(options.Env, r.Env...)
+	options.Binds = append(options.Binds, r.Volumes...)
+}
@@ -1,20 +1,16 @@
 package run
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"net"
+	"io"
 	"os"
-	"os/exec"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/henvic/uilive"
 	"github.com/wedeploy/cli/defaults"
-	"github.com/wedeploy/cli/projects"
 	"github.com/wedeploy/cli/verbose"
 )
 
@@ -29,8 +25,11 @@ const (
 // ErrHostNotFound is used when host is not found
 var ErrHostNotFound = errors.New("You need to be connected to a network.")
 
-// WeDeployImage is the docker image for the WeDeploy infrastructure
-var WeDeployImage = "wedeploy/local:" + defaults.WeDeployImageTag
+// WeDeployImage is the default docker image for the WeDeploy infrastructure
+var WeDeployImage = ImageRepository + ":" + defaults.WeDeployImageTag
+
+// Label identifies the containers of the WeDeploy infrastructure
+const Label = "com.wedeploy.local"
 
 var bin = "docker"
 
@@ -39,418 +38,375 @@ type Flags struct {
 	Detach   bool
 	DryRun   bool
 	ViewMode bool
+	Fresh    bool
+	Ports    []string
+	Image    string
+	HostIP   string
+	Memory   string
+	CPUs     string
+	Env      []string
+	Volumes  []string
+	Network  string
 }
 
 // DockerMachine for the run command
 type DockerMachine struct {
-	Container   string
-	Flags       Flags
-	upTime      time.Time
-	waitProcess *os.Process
-	livew       *uilive.Writer
-	tickerd     chan bool
-	end         chan bool
-	started     chan bool
+	Container string
+	Flags     Flags
+	Docker    Docker
+	Ports     []PortBinding
+	Pin       Pin
+	Resources Resources
+	Stdout    io.Writer
+	Stderr    io.Writer
+	upTime    time.Time
+	livew     *uilive.Writer
 }
 
-var portsArgs = []string{
-	"-p", "24224:24224/tcp",
-	"-p", "24224:24224/udp",
-	"-p", "80:80",
-	"-p", "5001:5001",
-	"-p", "5005:5005",
-	"-p", "8001:8001",
-	"-p", "8080:8080",
-	"-p", "8500:8500",
-	"-p", "9200:9200",
-}
+var (
+	// ReadyTimeout is how long to wait for the API to answer after starting
+	ReadyTimeout = 100 * time.Second
 
-// GetWeDeployHost gets the WeDeploy infrastructure host
-// This is a temporary solution and it is NOT reliable
-func GetWeDeployHost() (string, error) {
-	var addrs, err = net.InterfaceAddrs()
+	// readyInterval is how often the API is checked while starting
+	readyInterval = time.Second
 
-	if err != nil {
-		return "", err
+	// checkPorts checks the host ports; replaced on tests
+	checkPorts = CheckPorts
+)
+
+// New creates a DockerMachine for the given flags
+// It writes to the standard output and error streams unless changed.
+func New(docker Docker, flags Flags) (*DockerMachine, error) {
+	var dm = &DockerMachine{
+		Flags:  flags,
+		Docker: docker,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
 	}
 
-	for _, addr := range addrs {
-		var ip = addr.(*net.IPNet)
+	var err error
 
-		if !ip.IP.IsLoopback() && ip.IP.To4() != nil {
-			return strings.SplitN(ip.String(), "/", 2)[0], nil
-		}
+	if dm.Ports, err = Ports(flags.Ports); err != nil {
+		return nil, err
 	}
 
-	return "", ErrHostNotFound
+	if dm.Pin, err = ParsePin(flags.Image); err != nil {
+		return nil, err
+	}
+
+	dm.Resources, err = ParseResources(flags.Memory, flags.CPUs,
+		flags.Env, flags.Volumes, flags.Network)
+
+	return dm, err
 }
 
 // Run runs the WeDeploy infrastructure
-func Run(flags Flags) {
-	checkDockerExists()
+// Unless detached, it blocks until the infrastructure stops
+// or the context is canceled, which stops it.
+func Run(ctx context.Context, docker Docker, flags Flags) error {
+	var dm, err = New(docker, flags)
 
-	var dm = &DockerMachine{
-		Flags: flags,
+	if err != nil {
+		return err
 	}
 
-	dm.Run()
+	return dm.Run(ctx)
 }
 
 // Stop stops the WeDeploy infrastructure
-func Stop() {
-	checkDockerExists()
+func Stop(docker Docker) error {
+	var ids, err = docker.ListContainers(Label, false)
 
-	var dm = &DockerMachine{}
-	dm.Stop()
-}
-
-// Run executes the WeDeploy infraestruture
-func (dm *DockerMachine) Run() {
-	dm.prepare()
-
-	if dm.Flags.Detach {
-		dm.end <- true
+	switch {
+	case err != nil:
+		return err
+	case len(ids) == 0:
+		return ErrNotRunning
 	}
 
-	if len(dm.Container) == 0 && dm.Flags.ViewMode {
-		println("View mode is not available.")
-		println("WeDeploy is shutdown.")
-		os.Exit(1)
+	if err = docker.Stop(ids[0]); err != nil {
+		return StopError{ids[0], err}
 	}
 
-	var already = len(dm.Container) != 0 && !dm.Flags.DryRun
+	return nil
+}
 
-	if already {
-		fmt.Println("WeDeploy is already running.")
+// Run executes the WeDeploy infraestruture
+func (dm *DockerMachine) Run(ctx context.Context) error {
+	if err := dm.prepare(); err != nil {
+		return err
 	}
 
-	dm.maybeStopListener()
+	var already = len(dm.Container) != 0 && !dm.Flags.DryRun
 
-	if !already {
-		dm.start()
+	switch {
+	case len(dm.Container) == 0 && dm.Flags.ViewMode:
+		return ErrNotRunning
+	case already && dm.Flags.Fresh:
+		return ErrAlreadyRunning
+	case already:
+		fmt.Fprintln(dm.Stdout, "WeDeploy is already running.")
+	default:
+		if err := dm.start(ctx); err != nil || dm.Flags.DryRun {
+			return err
+		}
 	}
 
-	dm.maybeWaitEnd()
-	dm.started <- true
-	go dm.waitReadyState()
-	<-dm.end
-}
-
-// Stop stops the machine
-func (dm *DockerMachine) Stop() {
-	dm.testAlreadyRunning()
-
-	if dm.Container == "" {
-		println("we run is not running.")
-		os.Exit(1)
+	if dm.Flags.Detach {
+		return nil
 	}
 
-	stop(dm.Container)
-
-	if dm.waitProcess != nil {
-		fmt.Println("sending sigterm signal")
-		dm.waitProcess.Signal(syscall.SIGTERM)
-	}
+	return dm.attach(ctx)
 }
 
-func (dm *DockerMachine) waitEnd() {
-	var p, err = runWait(dm.Container)
+// attach waits until the infrastructure stops, stopping it if the context is canceled
+func (dm *DockerMachine) attach(ctx context.Context) error {
+	var ended = make(chan error, 1)
+	var waitCtx, cancel = context.WithCancel(ctx)
+	var readyDone = make(chan struct{})
+
+	go func() {
+		var _, err = dm.Docker.Wait(dm.Container)
+		ended <- err
+	}()
+
+	go func() {
+		dm.waitReadyState(waitCtx)
+		close(readyDone)
+	}()
+
+	defer func() {
+		cancel()
+		<-readyDone
+	}()
+
+	select {
+	case err := <-ended:
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Running wait error: %v", err)
+		fmt.Fprintln(dm.Stdout, "WeDeploy is shutdown.")
+		return nil
+	case <-ctx.Done():
 	}
 
-	verbose.Debug("docker wait process pid:", p.Pid)
-	dm.waitProcess = p
+	// leave the infrastructure running when only viewing it
+	if dm.Flags.ViewMode {
+		return nil
+	}
 
-	var ps *os.ProcessState
-	ps, err = p.Wait()
+	cancel()
+	<-readyDone
+	fmt.Fprintln(dm.Stdout, "\nStopping WeDeploy.")
 
-	switch {
-	case err != nil:
-		fmt.Fprintf(os.Stderr, "Wait call error: %v", err)
-		os.Exit(1)
-	case ps.Success():
-		fmt.Println("WeDeploy is shutdown.")
-		os.Exit(0)
-	default:
-		println("WeDeploy wait failure.")
-		os.Exit(1)
+	if err := dm.Docker.Stop(dm.Container); err != nil {
+		return StopError{dm.Container, err}
 	}
-}
 
-func (dm *DockerMachine) maybeWaitEnd() {
-	if !dm.Flags.Detach {
-		go dm.waitEnd()
-	}
+	return <-ended
 }
 
-func (dm *DockerMachine) waitReadyState() {
+func (dm *DockerMachine) waitReadyState(ctx context.Context) {
+	var ticker = time.NewTicker(readyInterval)
+	var deadline = dm.upTime.Add(ReadyTimeout)
 	var tries = 1
+
+	defer ticker.Stop()
 	dm.livew.Start()
-	dm.checkConnection()
-	for tries <= 100 {
-		var _, err = projects.List()
-
-		if err == nil {
-			dm.tickerd <- true
-			time.Sleep(2 * dm.livew.RefreshInterval)
-			fmt.Fprintf(dm.livew, "WeDeploy is ready!\n")
-			dm.livew.Stop()
+
+	for {
+		var err = checkAPI()
+
+		switch {
+		case err == nil:
+			dm.warmupEnd("WeDeploy is ready!")
 			dm.ready()
 			return
+		case time.Now().After(deadline):
+			dm.warmupEnd("WeDeploy is up.")
+			fmt.Fprintln(dm.Stderr, "Failed to verify if WeDeploy is working correctly.")
+			return
 		}
 
 		verbose.Debug(fmt.Sprintf("Trying to read projects tries #%v: %v", tries, err))
 		tries++
-		time.Sleep(1 * time.Second)
+
+		select {
+		case t := <-ticker.C:
+			dm.warmup(t)
+		case <-ctx.Done():
+			dm.livew.Stop()
+			return
+		}
 	}
+}
 
-	dm.tickerd <- true
+func (dm *DockerMachine) warmup(t time.Time) {
+	var p = WarmupOn
+
+	if t.Second()%2 == 0 {
+		p = WarmupOff
+	}
+
+	var dots = strings.Repeat(".", t.Second()%3+1)
+
+	fmt.Fprintf(dm.livew,
+		"%c Starting WeDeploy%s %ds\n", p, dots,
+		int(t.Sub(dm.upTime).Seconds()))
+}
 
-	time.Sleep(2 * dm.livew.RefreshInterval)
-	fmt.Fprintf(dm.livew, "WeDeploy is up.\n")
+func (dm *DockerMachine) warmupEnd(message string) {
+	fmt.Fprintf(dm.livew, "%v\n", message)
 	dm.livew.Stop()
-	println("Failed to verify if WeDeploy is working correctly.")
 }
 
-func (dm *DockerMachine) start() {
-	var args = getRunCommandEnv()
-	var running = "docker " + strings.Join(args, " ")
+func (dm *DockerMachine) start(ctx context.Context) error {
+	var host, err = DetectHostIP(dm.Flags.HostIP)
+
+	if err != nil {
+		return err
+	}
+
+	var options = dm.getContainerOptions(host)
+	var running = "docker " + strings.Join(options.Args(), " ")
 
 	if dm.Flags.DryRun && !verbose.Enabled {
-		println(running)
+		fmt.Fprintln(dm.Stdout, running)
+		fmt.Fprintln(dm.Stdout, "WEDEPLOY_HOST_IP: "+host.String())
 	} else {
 		verbose.Debug(running)
+		verbose.Debug("WEDEPLOY_HOST_IP:", host.String())
 	}
 
-	if dm.Flags.DryRun {
-		os.Exit(0)
-	}
+	var conflicts = checkPorts(dm.Ports)
 
-	if !hasCurrentWeDeployImage() {
-		pull()
+	switch {
+	case len(conflicts) != 0 && dm.Flags.DryRun:
+		fmt.Fprintln(dm.Stderr, PortConflictsError{conflicts}.Error())
+		return nil
+	case dm.Flags.DryRun:
+		return nil
+	case len(conflicts) != 0:
+		return PortConflictsError{conflicts}
 	}
 
-	dm.Container = startCmd(args...)
-	verbose.Debug("Docker container ID:", dm.Container)
-}
+	if dm.Flags.Fresh {
+		fmt.Fprintln(dm.Stdout, "Removing WeDeploy data to start from a clean state.")
 
-func (dm *DockerMachine) stop() {
-	stop(dm.Container)
-	dm.end <- true
-}
-
-func (dm *DockerMachine) maybeStopListener() {
-	if !dm.Flags.Detach && !dm.Flags.ViewMode {
-		dm.stopListener()
+		if err = Reset(dm.Docker); err != nil {
+			return err
+		}
 	}
-}
 
-func (dm *DockerMachine) stopListener() {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	go dm.stopEvent(sigs)
-}
+	if err = dm.pullIfMissing(ctx); err != nil {
+		return err
+	}
 
-func (dm *DockerMachine) stopEvent(sigs chan os.Signal) {
-	<-sigs
-	verbose.Debug("WeDeploy stop event called. Waiting started signal.")
-	<-dm.started
-	verbose.Debug("Started end signal received.")
+	dm.checkDigest()
 
-	dm.tickerd <- true
-	fmt.Println("\nStopping WeDeploy.")
-	dm.stop()
-}
-
-func (dm *DockerMachine) checkConnection() {
-	var ticker = time.NewTicker(time.Second)
-	go dm.checkConnectionCounter(ticker)
-}
+	verbose.Debug("Starting WeDeploy")
 
-func (dm *DockerMachine) checkConnectionCounter(ticker *time.Ticker) {
-	for {
-		select {
-		case t := <-ticker.C:
-			var p = WarmupOn
-			if t.Second()%2 == 0 {
-				p = WarmupOff
-			}
-
-			var dots = strings.Repeat(".", t.Second()%3+1)
-
-			fmt.Fprintf(dm.livew,
-				"%c Starting WeDeploy%s %ds\n", p, dots,
-				int(-dm.upTime.Sub(t).Seconds()))
-		case <-dm.tickerd:
-			ticker.Stop()
-			ticker = nil
-			return
-		}
+	if dm.Container, err = dm.Docker.Start(options); err != nil {
+		return err
 	}
+
+	verbose.Debug("Docker container ID:", dm.Container)
+	return nil
 }
 
-func (dm *DockerMachine) prepare() {
+func (dm *DockerMachine) prepare() error {
 	dm.upTime = time.Now()
-	dm.testAlreadyRunning()
 	dm.livew = uilive.New()
-	dm.tickerd = make(chan bool, 1)
-	dm.started = make(chan bool, 1)
-	dm.end = make(chan bool, 1)
-}
+	dm.livew.Out = dm.Stdout
 
-func (dm *DockerMachine) ready() {
-	fmt.Print("You can now test your apps locally.")
-
-	if !dm.Flags.ViewMode && !dm.Flags.Detach {
-		fmt.Print(" Press Ctrl+C to shut it down when you are done.")
-	}
+	var ids, err = dm.Docker.ListContainers(Label, false)
 
-	if !dm.Flags.ViewMode && dm.Flags.Detach {
-		fmt.Print("\nRunning on background. \"we stop\" stops the infrastructure.")
-	}
-
-	fmt.Println("")
-}
-
-func (dm *DockerMachine) testAlreadyRunning() {
-	var args = []string{
-		"ps",
-		"--filter",
-		"ancestor=" + WeDeployImage,
-		"--format",
-		"{{.ID}}",
+	if err != nil {
+		return err
 	}
 
-	var docker = exec.Command(bin, args...)
-	var buf bytes.Buffer
-	docker.Stderr = os.Stderr
-	docker.Stdout = &buf
-
-	if err := docker.Run(); err != nil {
-		println("docker ps error:", err.Error())
-		os.Exit(1)
+	if len(ids) != 0 {
+		dm.Container = ids[0]
 	}
 
-	dm.Container = strings.TrimSpace(buf.String())
 	verbose.Debug("Docker container ID:", dm.Container)
+	return nil
 }
 
-func checkDockerExists() {
-	if !existsDependency(bin) {
-		println("Docker is not installed. Download it from http://docker.com/")
-		os.Exit(1)
-	}
-}
-
-func getWeDeployHost() string {
-	var address, err = GetWeDeployHost()
+func (dm *DockerMachine) ready() {
+	fmt.Fprintln(dm.Stdout, "WeDeploy API: "+LocalEndpoint(dm.Ports))
+	fmt.Fprint(dm.Stdout, "You can now test your apps locally.")
 
-	if err != nil {
-		println("Could not find a suitable host.")
-		println("To use we run you need a suitable network interface on.")
-		println(err.Error())
-		os.Exit(1)
+	if !dm.Flags.ViewMode {
+		fmt.Fprint(dm.Stdout, " Press Ctrl+C to shut it down when you are done.")
 	}
 
-	return address
+	fmt.Fprintln(dm.Stdout, "")
 }
 
-func getRunCommandEnv() []string {
-	var address = getWeDeployHost()
-	var args = []string{"run"}
-
-	args = append(args, portsArgs...)
-	args = append(args, []string{
-		"-v",
+func (dm *DockerMachine) getContainerOptions(host HostIP) ContainerOptions {
+	var binds = []string{
 		"/var/run/docker.sock:/var/run/docker-host.sock",
-		"--privileged",
-		"-e",
-		"WEDEPLOY_HOST_IP=" + address,
-		"--detach",
-		WeDeployImage,
-	}...)
-
-	return args
-}
-
-func hasCurrentWeDeployImage() bool {
-	var args = []string{
-		"inspect",
-		"--type",
-		"image",
-		WeDeployImage,
 	}
 
-	var docker = exec.Command(bin, args...)
-	docker.Stderr = os.Stderr
+	for _, v := range Volumes {
+		binds = append(binds, v.String())
+	}
 
-	if err := docker.Run(); err != nil {
-		verbose.Debug("docker inspect error:", err.Error())
-		return false
+	var options = ContainerOptions{
+		Image:      dm.Pin.Image(),
+		Ports:      dm.Ports,
+		Binds:      binds,
+		Privileged: true,
+		Env: []string{
+			"WEDEPLOY_HOST_IP=" + host.IP.String(),
+		},
+		Labels: map[string]string{
+			Label: "true",
+		},
 	}
 
-	return true
+	dm.Resources.apply(&options)
+	return options
 }
 
-func getDockerPath() string {
-	var path, err = exec.LookPath(bin)
+func (dm *DockerMachine) pullIfMissing(ctx context.Context) error {
+	var image = dm.Pin.Image()
+	var has, err = dm.Docker.HasImage(image)
 
 	if err != nil {
-		panic(err)
+		verbose.Debug("docker inspect error:", err.Error())
 	}
 
-	return path
-}
-
-func pull() {
-	fmt.Println("Pulling WeDeploy infrastructure docker image. Hold on.")
-	var docker = exec.Command(bin, "pull", WeDeployImage)
-	docker.Stderr = os.Stderr
-	docker.Stdout = os.Stdout
-
-	if err := docker.Run(); err != nil {
-		println("docker pull error:", err.Error())
-		os.Exit(1)
+	if has {
+		return nil
 	}
-}
 
-func startCmd(args ...string) string {
-	verbose.Debug("Starting WeDeploy")
-	var docker = exec.Command(bin, args...)
-	var dockerContainerBuf bytes.Buffer
-	docker.Stderr = os.Stderr
-	docker.Stdout = &dockerContainerBuf
-
-	if err := docker.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, "docker run error:", err)
-		os.Exit(1)
+	fmt.Fprintln(dm.Stdout, "Pulling WeDeploy infrastructure docker image. Hold on.")
+
+	if err = dm.Docker.Pull(image, dm.Stdout); err != nil {
+		return PullError{image, err}
 	}
 
-	var dockerContainer = strings.TrimSpace(dockerContainerBuf.String())
-	return dockerContainer
+	// the pull can't be interrupted, but the start can be avoided
+	return ctx.Err()
 }
 
-func stop(container string) {
-	var stop = exec.Command(bin, "stop", container)
-
-	stopFeedback(stop.Run())
-}
+func (dm *DockerMachine) checkDigest() {
+	var digest, ok, err = CheckDigest(dm.Docker, dm.Pin)
 
-func stopFeedback(err error) {
-	switch err.(type) {
-	case nil:
-	case *exec.ExitError:
-		println("warning: still stopping WeDeploy on background\n")
-		os.Exit(1)
-	default:
-		println("docker stop error:", err.Error())
-		os.Exit(1)
+	switch {
+	case err != nil:
+		verbose.Debug("Can't verify the image digest:", err)
+	case !ok:
+		fmt.Fprintln(dm.Stderr, DigestWarning(dm.Pin, digest))
 	}
 }
 
-func existsDependency(cmd string) bool {
-	_, err := exec.LookPath(cmd)
-	return err == nil
+// DigestWarning for when the local image doesn't match the pinned digest
+func DigestWarning(pin Pin, digest string) string {
+	return fmt.Sprintf("warning: local image %v has digest %v, but %v is pinned.\n"+
+		"Run \"we run upgrade\" or update the pinned digest.",
+		pin.Image(), digest, pin.Digest)
 }
@@ -1,27 +1,1184 @@
 package run
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
-type ExistsDependencyProvider struct {
-	cmd  string
-	find bool
+type fakeDaemon struct {
+	containers []string
+	images     map[string]bool
+	created    createContainer
+	stopped    []string
 }
 
-var ExistsDependencyCases = []ExistsDependencyProvider{
-	{"git", true},
-	{fmt.Sprintf("not-found-%d", rand.Int()), false},
+func (f *fakeDaemon) handler() http.Handler {
+	var mux = http.NewServeMux()
+
+	mux.HandleFunc("/v1.24/_ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "OK")
+	})
+
+	mux.HandleFunc("/v1.24/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filters") != `{"label":["com.wedeploy.local"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"message": "unexpected filters"}`)
+			return
+		}
+
+		var list = []map[string]string{}
+
+		for _, c := range f.containers {
+			list = append(list, map[string]string{"Id": c})
+		}
+
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	mux.HandleFunc("/v1.24/images/", func(w http.ResponseWriter, r *http.Request) {
+		var name = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1.24/images/"), "/json")
+
+		if !f.images[name] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"message": "No such image: %v"}`, name)
+			return
+		}
+
+		fmt.Fprintf(w, "{}")
+	})
+
+	mux.HandleFunc("/v1.24/images/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") != "wedeploy/local" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprintf(w, `[{"Id": "sha256:1", "RepoTags": ["wedeploy/local:latest"], `+
+			`"RepoDigests": ["wedeploy/local@sha256:abc"]}]`)
+	})
+
+	mux.HandleFunc("/v1.24/images/create", func(w http.ResponseWriter, r *http.Request) {
+		var image = r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+
+		if image != "wedeploy/local:latest" {
+			fmt.Fprintf(w, `{"status": "Pulling"}`+"\n"+`{"error": "not found"}`)
+			return
+		}
+
+		f.images[image] = true
+		fmt.Fprintf(w, `{"status": "Pulling from wedeploy/local", "id": "latest"}`+"\n")
+		fmt.Fprintf(w, `{"status": "Download complete"}`+"\n")
+	})
+
+	mux.HandleFunc("/v1.24/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&f.created); err != nil {
+			panic(err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"Id": "abc"}`)
+	})
+
+	mux.HandleFunc("/v1.24/containers/abc/start", func(w http.ResponseWriter, r *http.Request) {
+		f.containers = append(f.containers, "abc")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/v1.24/containers/abc/stop", func(w http.ResponseWriter, r *http.Request) {
+		if len(f.containers) == 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		f.stopped = append(f.stopped, "abc")
+		f.containers = nil
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/v1.24/containers/abc/wait", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"StatusCode": 0}`)
+	})
+
+	return mux
+}
+
+func newFakeAPIDocker() (*fakeDaemon, *APIDocker, *httptest.Server) {
+	var daemon = &fakeDaemon{
+		images: map[string]bool{},
+	}
+
+	var server = httptest.NewServer(daemon.handler())
+
+	return daemon, &APIDocker{
+		Client: server.Client(),
+		URL:    server.URL,
+	}, server
+}
+
+func TestAPIDocker(t *testing.T) {
+	var daemon, docker, server = newFakeAPIDocker()
+	defer server.Close()
+
+	if err := docker.Ping(); err != nil {
+		t.Errorf("Expected ping to succeed, got %v instead", err)
+	}
+
+	if has, err := docker.HasImage(WeDeployImage); has || err != nil {
+		t.Errorf("Expected image to be missing, got %v, %v instead", has, err)
+	}
+
+	var out bytes.Buffer
+
+	if err := docker.Pull(WeDeployImage, &out); err != nil {
+		t.Errorf("Expected pull to succeed, got %v instead", err)
+	}
+
+	if out.String() != "latest: Pulling from wedeploy/local \nDownload complete\n" {
+		t.Errorf("Unexpected pull progress %q", out.String())
+	}
+
+	if has, err := docker.HasImage(WeDeployImage); !has || err != nil {
+		t.Errorf("Expected image to exist, got %v, %v instead", has, err)
+	}
+
+	var id, err = docker.Start(ContainerOptions{
+		Image:      WeDeployImage,
+		Ports:      []PortBinding{{"8081", "80", ""}, {"24224", "24224", "udp"}},
+		Env:        []string{"FOO=bar"},
+		Labels:     map[string]string{Label: "true"},
+		Privileged: true,
+	})
+
+	if id != "abc" || err != nil {
+		t.Errorf("Expected container abc to start, got %v, %v instead", id, err)
+	}
+
+	var wantCreated = createContainer{
+		Image:  WeDeployImage,
+		Env:    []string{"FOO=bar"},
+		Labels: map[string]string{Label: "true"},
+		ExposedPorts: map[string]struct{}{
+			"80/tcp":    {},
+			"24224/udp": {},
+		},
+		HostConfig: hostConfig{
+			PortBindings: map[string][]portBinding{
+				"80/tcp":    {{"8081"}},
+				"24224/udp": {{"24224"}},
+			},
+			Privileged: true,
+		},
+	}
+
+	if !reflect.DeepEqual(daemon.created, wantCreated) {
+		t.Errorf("Wanted container %+v, got %+v instead", wantCreated, daemon.created)
+	}
+
+	var ids []string
+
+	if ids, err = docker.ListContainers(Label, false); len(ids) != 1 || err != nil {
+		t.Errorf("Expected container to be listed, got %v, %v instead", ids, err)
+	}
+
+	var images []ImageInfo
+	var wantImages = []ImageInfo{{
+		ID:          "sha256:1",
+		RepoTags:    []string{"wedeploy/local:latest"},
+		RepoDigests: []string{"wedeploy/local@sha256:abc"},
+	}}
+
+	if images, err = docker.ListImages(ImageRepository); err != nil ||
+		!reflect.DeepEqual(images, wantImages) {
+		t.Errorf("Wanted images %+v, got %+v, %v instead", wantImages, images, err)
+	}
+
+	var code int
+
+	if code, err = docker.Wait("abc"); code != 0 || err != nil {
+		t.Errorf("Expected wait to return 0, got %v, %v instead", code, err)
+	}
+
+	if err = docker.Stop("abc"); err != nil || len(daemon.stopped) != 1 {
+		t.Errorf("Expected container to stop, got %v instead", err)
+	}
+
+	if err = docker.Stop("abc"); err != nil {
+		t.Errorf("Expected stopping a stopped container to succeed, got %v instead", err)
+	}
+}
+
+func TestAPIDockerErrors(t *testing.T) {
+	var _, docker, server = newFakeAPIDocker()
+	defer server.Close()
+
+	var err = docker.Pull("wedeploy/local:missing", &bytes.Buffer{})
+
+	if de, ok := err.(DockerError); !ok || de.Message != "not found" {
+		t.Errorf("Expected pull error, got %v instead", err)
+	}
+
+	_, err = docker.ListContainers("other", false)
+
+	if de, ok := err.(DockerError); !ok || de.Code != http.StatusBadRequest ||
+		de.Message != "unexpected filters" {
+		t.Errorf("Expected docker error, got %v instead", err)
+	}
+}
+
+func TestNewAPIDocker(t *testing.T) {
+	var cases = map[string]string{
+		"":                          "http://docker",
+		"unix:///tmp/docker.sock":   "http://docker",
+		"tcp://192.168.99.100:2375": "http://192.168.99.100:2375",
+	}
+
+	for host, want := range cases {
+		var docker, err = NewAPIDocker(host)
+
+		if err != nil || docker.URL != want {
+			t.Errorf("Wanted URL %v for host %q, got %v, %v instead", want, host, docker, err)
+		}
+	}
+
+	if _, err := NewAPIDocker("ftp://example.com"); err == nil {
+		t.Errorf("Expected unsupported docker host error")
+	}
+}
+
+func TestContainerOptionsArgs(t *testing.T) {
+	var options = ContainerOptions{
+		Image:      "wedeploy/local:latest",
+		Ports:      []PortBinding{{"80", "80", ""}, {"24224", "24224", "udp"}},
+		Binds:      []string{"/var/run/docker.sock:/var/run/docker-host.sock"},
+		Env:        []string{"WEDEPLOY_HOST_IP=10.0.0.1"},
+		Labels:     map[string]string{"b": "2", "a": "1"},
+		Privileged: true,
+	}
+
+	var want = []string{
+		"run",
+		"-p", "80:80",
+		"-p", "24224:24224/udp",
+		"-v", "/var/run/docker.sock:/var/run/docker-host.sock",
+		"--privileged",
+		"-e", "WEDEPLOY_HOST_IP=10.0.0.1",
+		"--label", "a=1",
+		"--label", "b=2",
+		"--detach",
+		"wedeploy/local:latest",
+	}
+
+	if got := options.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted args %v, got %v instead", want, got)
+	}
+}
+
+func TestSplitImageTag(t *testing.T) {
+	var cases = map[string][2]string{
+		"wedeploy/local:1.0":        {"wedeploy/local", "1.0"},
+		"wedeploy/local":            {"wedeploy/local", "latest"},
+		"localhost:5000/local":      {"localhost:5000/local", "latest"},
+		"localhost:5000/local:beta": {"localhost:5000/local", "beta"},
+	}
+
+	for image, want := range cases {
+		if name, tag := splitImageTag(image); name != want[0] || tag != want[1] {
+			t.Errorf("Wanted %v for %v, got %v %v instead", want, image, name, tag)
+		}
+	}
+}
+
+func TestPorts(t *testing.T) {
+	var ports, err = Ports([]string{"8081:80", "9080:8080/tcp", "24225:24224", "3000:3000/udp"})
+
+	if err != nil {
+		panic(err)
+	}
+
+	var want = []PortBinding{
+		{"24225", "24224", "tcp"},
+		{"24225", "24224", "udp"},
+		{"8081", "80", ""},
+		{"5001", "5001", ""},
+		{"5005", "5005", ""},
+		{"8001", "8001", ""},
+		{"9080", "8080", ""},
+		{"8500", "8500", ""},
+		{"9200", "9200", ""},
+		{"3000", "3000", "udp"},
+	}
+
+	if !reflect.DeepEqual(ports, want) {
+		t.Errorf("Wanted ports %v, got %v instead", want, ports)
+	}
+
+	if endpoint := LocalEndpoint(ports); endpoint != "http://localhost:9080/" {
+		t.Errorf("Wanted remapped local endpoint, got %v instead", endpoint)
+	}
+
+	if endpoint := LocalEndpoint(defaultPorts); endpoint != "http://localhost:8080/" {
+		t.Errorf("Wanted default local endpoint, got %v instead", endpoint)
+	}
+}
+
+func TestPortsDefaultsUnchanged(t *testing.T) {
+	if _, err := Ports([]string{"1:80"}); err != nil {
+		panic(err)
+	}
+
+	if defaultPorts[2].Host != "80" {
+		t.Errorf("Expected default ports to not be modified")
+	}
+}
+
+func TestPortsInvalid(t *testing.T) {
+	var cases = []string{"80", "a:80", "80:80:80", "0:80", "80:70000", "80:80/sctp"}
+
+	for _, c := range cases {
+		if _, err := Ports([]string{c}); err != (InvalidPortError{c}) {
+			t.Errorf("Expected invalid port error for %v, got %v instead", c, err)
+		}
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	var l, err = net.Listen("tcp", ":0")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer l.Close()
+
+	var port = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	var conflicts = CheckPorts([]PortBinding{
+		{port, "80", ""},
+		{port, "80", "udp"},
+	})
+
+	if len(conflicts) != 1 || conflicts[0].Port.Host != port {
+		t.Fatalf("Expected conflict on port %v, got %v instead", port, conflicts)
+	}
+
+	if runtime.GOOS == "linux" &&
+		!strings.Contains(conflicts[0].Process, fmt.Sprintf("(pid %d)", os.Getpid())) {
+		t.Errorf("Expected port owner to be this process, got %v instead", conflicts[0].Process)
+	}
+}
+
+type fakeDocker struct {
+	running  []string
+	stopped  []string
+	images   map[string]bool
+	volumes  map[string]bool
+	started  []ContainerOptions
+	removed  []string
+	exitCode int
+	info     ContainerInfo
+	image    ImageInfo
+	pulled   ImageInfo
+	pullErr  error
+	waiting  chan bool
+	// waitEnded is only used by Stop, as waiting is read concurrently
+	waitEnded bool
+}
+
+func newFakeDocker() *fakeDocker {
+	return &fakeDocker{
+		images: map[string]bool{},
+		volumes: map[string]bool{
+			"wedeploy-local-data": true,
+		},
+	}
+}
+
+func (f *fakeDocker) ListContainers(label string, all bool) ([]string, error) {
+	var ids = append([]string{}, f.running...)
+
+	if all {
+		ids = append(ids, f.stopped...)
+	}
+
+	return ids, nil
+}
+
+func (f *fakeDocker) ListImages(repository string) ([]ImageInfo, error) {
+	if f.image.ID == "" {
+		return []ImageInfo{}, nil
+	}
+
+	return []ImageInfo{f.image}, nil
+}
+
+func (f *fakeDocker) HasImage(image string) (bool, error) {
+	return f.images[image], nil
+}
+
+func (f *fakeDocker) Pull(image string, out io.Writer) error {
+	if f.pullErr != nil {
+		return f.pullErr
+	}
+
+	f.images[image] = true
+
+	if f.pulled.ID != "" {
+		f.image = f.pulled
+	}
+
+	return nil
+}
+
+func (f *fakeDocker) Start(options ContainerOptions) (string, error) {
+	f.started = append(f.started, options)
+	var id = fmt.Sprintf("container-%d", len(f.started))
+	f.running = append(f.running, id)
+	return id, nil
+}
+
+func (f *fakeDocker) Stop(id string) error {
+	f.running = removeID(f.running, id)
+	f.stopped = append(f.stopped, id)
+
+	if f.waiting != nil && !f.waitEnded {
+		close(f.waiting)
+		f.waitEnded = true
+	}
+
+	return nil
+}
+
+// Wait blocks until Stop is called when waiting is set,
+// otherwise the container exits immediately
+func (f *fakeDocker) Wait(id string) (int, error) {
+	if f.waiting != nil {
+		<-f.waiting
+		return f.exitCode, nil
+	}
+
+	return f.exitCode, f.Stop(id)
+}
+
+func (f *fakeDocker) RemoveContainer(id string) error {
+	f.stopped = removeID(f.stopped, id)
+	f.removed = append(f.removed, id)
+	return nil
+}
+
+func (f *fakeDocker) RemoveVolume(name string) error {
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *fakeDocker) InspectContainer(id string) (ContainerInfo, error) {
+	if f.info.ID != id {
+		return ContainerInfo{}, ErrNotFound
+	}
+
+	return f.info, nil
+}
+
+func (f *fakeDocker) InspectImage(image string) (ImageInfo, error) {
+	return f.image, nil
+}
+
+func removeID(list []string, id string) []string {
+	var l = []string{}
+
+	for _, i := range list {
+		if i != id {
+			l = append(l, i)
+		}
+	}
+
+	return l
+}
+
+func setupHome() string {
+	var home, err = ioutil.TempDir(os.TempDir(), "we")
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err = os.Setenv("WEDEPLOY_CUSTOM_HOME", home); err != nil {
+		panic(err)
+	}
+
+	return home
+}
+
+func teardownHome(home string) {
+	if err := os.Unsetenv("WEDEPLOY_CUSTOM_HOME"); err != nil {
+		panic(err)
+	}
+
+	if err := os.RemoveAll(home); err != nil {
+		panic(err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	var docker = newFakeDocker()
+	docker.running = []string{"running"}
+
+	if err := Reset(docker); err != ErrAlreadyRunning {
+		t.Errorf("Expected reset to fail while running, got %v instead", err)
+	}
+
+	docker.running = nil
+	docker.stopped = []string{"stopped"}
+
+	if err := Reset(docker); err != nil {
+		t.Errorf("Expected reset to succeed, got %v instead", err)
+	}
+
+	if len(docker.stopped) != 0 || len(docker.volumes) != 0 {
+		t.Errorf("Expected containers and volumes to be removed")
+	}
+}
+
+func TestSaveAndRestoreSnapshot(t *testing.T) {
+	var home = setupHome()
+	defer teardownHome(home)
+
+	var docker = newFakeDocker()
+	var path, err = SaveSnapshot(docker, "fixtures")
+
+	if err != nil {
+		t.Fatalf("Expected snapshot to be saved, got %v instead", err)
+	}
+
+	if path != filepath.Join(home, ".wedeploy", "snapshots", "fixtures.tar.gz") {
+		t.Errorf("Unexpected snapshot path %v", path)
+	}
+
+	var want = ContainerOptions{
+		Image: SnapshotImage,
+		Cmd:   []string{"tar", "czf", "/snapshots/fixtures.tar.gz", "-C", "/volumes", "."},
+		Binds: []string{
+			filepath.Join(home, ".wedeploy", "snapshots") + ":/snapshots",
+			"wedeploy-local-data:/volumes/wedeploy-local-data:ro",
+		},
+	}
+
+	if len(docker.started) != 1 || !reflect.DeepEqual(docker.started[0], want) {
+		t.Errorf("Wanted helper container %+v, got %+v instead", want, docker.started)
+	}
+
+	if len(docker.removed) != 1 || !docker.images[SnapshotImage] {
+		t.Errorf("Expected helper image to be pulled and helper container to be removed")
+	}
+
+	if err = RestoreSnapshot(docker, "fixtures"); err != ErrSnapshotNotFound {
+		t.Errorf("Expected snapshot not found error, got %v instead", err)
+	}
+
+	// the fake helper container doesn't write the tarball
+	if err = ioutil.WriteFile(path, []byte("tarball"), 0600); err != nil {
+		panic(err)
+	}
+
+	if err = RestoreSnapshot(docker, "fixtures"); err != nil {
+		t.Errorf("Expected snapshot to be restored, got %v instead", err)
+	}
+
+	if len(docker.volumes) != 0 {
+		t.Errorf("Expected volumes to be reset before restoring")
+	}
+
+	var restore = docker.started[1]
+
+	if restore.Binds[1] != "wedeploy-local-data:/volumes/wedeploy-local-data" ||
+		restore.Cmd[1] != "xzf" {
+		t.Errorf("Unexpected restore helper container %+v", restore)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	var home = setupHome()
+	defer teardownHome(home)
+
+	var docker = newFakeDocker()
+
+	if _, err := SaveSnapshot(docker, "../escape"); err != ErrInvalidSnapshotName {
+		t.Errorf("Expected invalid snapshot name error, got %v instead", err)
+	}
+
+	docker.exitCode = 1
+
+	if _, err := SaveSnapshot(docker, "failure"); err == nil ||
+		err.Error() != "tar exited with status 1" {
+		t.Errorf("Expected helper failure, got %v instead", err)
+	}
+
+	docker.running = []string{"running"}
+
+	if _, err := SaveSnapshot(docker, "running"); err != ErrAlreadyRunning {
+		t.Errorf("Expected snapshot to fail while running, got %v instead", err)
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	var defaultCheckAPI = checkAPI
+	defer func() {
+		checkAPI = defaultCheckAPI
+	}()
+
+	var apiErr = errors.New("connection refused")
+
+	checkAPI = func() error {
+		return apiErr
+	}
+
+	var l, err = net.Listen("tcp", "localhost:0")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer l.Close()
+
+	var port = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	var docker = newFakeDocker()
+	var status Status
+
+	if status, err = GetStatus(docker); err != nil || status.Running || status.Ready() {
+		t.Errorf("Expected infrastructure to not be running, got %+v, %v instead", status, err)
+	}
+
+	docker.running = []string{"abc"}
+	docker.info = ContainerInfo{
+		ID:        "abc",
+		Image:     WeDeployImage,
+		ImageID:   "sha256:123",
+		Running:   true,
+		StartedAt: time.Now().Add(-time.Hour),
+		Ports: []PortBinding{
+			{port, "8080", ""},
+			{"24224", "24224", "udp"},
+		},
+	}
+	docker.image = ImageInfo{
+		ID:          "sha256:123",
+		RepoDigests: []string{"wedeploy/local@sha256:abc"},
+	}
+
+	if status, err = GetStatus(docker); err != nil {
+		panic(err)
+	}
+
+	if !status.Running || status.Ready() || status.APIError != apiErr {
+		t.Errorf("Expected infrastructure to be running but not ready, got %+v instead", status)
+	}
+
+	var wantServices = []ServiceStatus{
+		{"api", PortBinding{port, "8080", ""}, true},
+	}
+
+	if !reflect.DeepEqual(status.Services, wantServices) {
+		t.Errorf("Wanted services %v, got %v instead", wantServices, status.Services)
+	}
+
+	if status.Image.Digest() != "sha256:abc" {
+		t.Errorf("Unexpected image digest %v", status.Image.Digest())
+	}
+
+	if uptime := status.Uptime(time.Now()); uptime < time.Hour {
+		t.Errorf("Unexpected uptime %v", uptime)
+	}
+
+	apiErr = nil
+
+	if status, err = WaitReady(docker, time.Second, time.Millisecond); err != nil || !status.Ready() {
+		t.Errorf("Expected infrastructure to be ready, got %+v, %v instead", status, err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	var docker = newFakeDocker()
+	var start = time.Now()
+	var status, err = WaitReady(docker, 50*time.Millisecond, 10*time.Millisecond)
+
+	if err != nil || status.Ready() {
+		t.Errorf("Expected infrastructure to not be ready, got %+v, %v instead", status, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected wait to time out, took %v", elapsed)
+	}
+}
+
+func TestDecodeInspect(t *testing.T) {
+	var out = `[{
+		"Id": "abc",
+		"Image": "sha256:123",
+		"Config": {"Image": "wedeploy/local:latest"},
+		"State": {
+			"Running": true,
+			"StartedAt": "2016-10-01T10:00:00.000000000Z",
+			"Health": {"Status": "healthy"}
+		},
+		"NetworkSettings": {
+			"Ports": {
+				"8080/tcp": [{"HostIp": "0.0.0.0", "HostPort": "9080"}],
+				"24224/udp": [{"HostIp": "0.0.0.0", "HostPort": "24224"}],
+				"9300/tcp": null
+			}
+		}
+	}]`
+
+	var c containerJSON
+
+	if err := decodeInspect(out, &c); err != nil {
+		panic(err)
+	}
+
+	var want = ContainerInfo{
+		ID:        "abc",
+		Image:     "wedeploy/local:latest",
+		ImageID:   "sha256:123",
+		Running:   true,
+		StartedAt: time.Date(2016, 10, 1, 10, 0, 0, 0, time.UTC),
+		Health:    "healthy",
+		Ports: []PortBinding{
+			{"24224", "24224", "udp"},
+			{"9080", "8080", ""},
+		},
+	}
+
+	if got := c.info(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted %+v, got %+v instead", want, got)
+	}
+
+	if err := decodeInspect("[]", &c); err != ErrNotFound {
+		t.Errorf("Expected not found error, got %v instead", err)
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	var digest = "sha256:" + strings.Repeat("ab", 32)
+	var cases = map[string]Pin{
+		"":              {"latest", ""},
+		"1.0":           {"1.0", ""},
+		"1.0@" + digest: {"1.0", digest},
+		"@" + digest:    {"latest", digest},
+	}
+
+	for s, want := range cases {
+		if got, err := ParsePin(s); got != want || err != nil {
+			t.Errorf("ParsePin(%q) should be %+v, got %+v, %v instead", s, want, got, err)
+		}
+	}
+
+	for _, s := range []string{"1.0@sha256:xyz", "a b", "1.0@", ".hidden"} {
+		if _, err := ParsePin(s); err != ErrInvalidPin {
+			t.Errorf("Expected ParsePin(%q) to fail, got %v instead", s, err)
+		}
+	}
+
+	var pin = Pin{"1.0", digest}
+
+	if pin.Image() != "wedeploy/local:1.0" || pin.String() != "1.0@"+digest {
+		t.Errorf("Unexpected pin representation %v, %v", pin.Image(), pin)
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	var docker = newFakeDocker()
+	docker.image = ImageInfo{
+		ID:          "sha256:1",
+		RepoDigests: []string{"wedeploy/local@sha256:abc"},
+	}
+
+	var cases = []struct {
+		pin Pin
+		ok  bool
+	}{
+		{Pin{"latest", ""}, true},
+		{Pin{"latest", "sha256:abc"}, true},
+		{Pin{"latest", "sha256:def"}, false},
+	}
+
+	for _, c := range cases {
+		var digest, ok, err = CheckDigest(docker, c.pin)
+
+		if digest != "sha256:abc" || ok != c.ok || err != nil {
+			t.Errorf("Expected digest check of %v to be %v, got %v, %v, %v instead",
+				c.pin, c.ok, digest, ok, err)
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	var docker = newFakeDocker()
+	var pin = Pin{"latest", ""}
+	docker.image = ImageInfo{ID: "sha256:1"}
+
+	if changed, err := Upgrade(docker, pin, &bytes.Buffer{}); changed || err != nil {
+		t.Errorf("Expected image to be up to date, got %v, %v instead", changed, err)
+	}
+
+	docker.pulled = ImageInfo{ID: "sha256:2"}
+
+	if changed, err := Upgrade(docker, pin, &bytes.Buffer{}); !changed || err != nil {
+		t.Errorf("Expected image to be upgraded, got %v, %v instead", changed, err)
+	}
+
+	if !docker.images["wedeploy/local:latest"] {
+		t.Errorf("Expected image to be pulled")
+	}
+
+	var images, err = ListImages(docker)
+
+	if len(images) != 1 || images[0].ID != "sha256:2" || err != nil {
+		t.Errorf("Expected upgraded image to be listed, got %v, %v instead", images, err)
+	}
+}
+
+func TestDetectHostIP(t *testing.T) {
+	var defaultListInterfaces = listInterfaces
+	var defaultRouteSource = routeSource
+
+	defer func() {
+		listInterfaces = defaultListInterfaces
+		routeSource = defaultRouteSource
+	}()
+
+	var up = net.FlagUp | net.FlagBroadcast
+	var ifaces = []hostInterface{
+		{"lo", up | net.FlagLoopback, []net.IP{net.ParseIP("127.0.0.1")}},
+		{"docker0", up, []net.IP{net.ParseIP("172.17.0.1")}},
+		{"tun0", up, []net.IP{net.ParseIP("10.8.0.2")}},
+		{"eth0", up, []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::10")}},
+		{"wlan0", up, []net.IP{net.ParseIP("192.168.1.10")}},
+	}
+
+	listInterfaces = func() ([]hostInterface, error) {
+		return ifaces, nil
+	}
+
+	var routes = map[string]string{}
+
+	routeSource = func(address string) (net.IP, error) {
+		if ip, ok := routes[address]; ok {
+			return net.ParseIP(ip), nil
+		}
+
+		return nil, errors.New("network is unreachable")
+	}
+
+	var cases = []struct {
+		routes map[string]string
+		ip     string
+		iface  string
+	}{
+		{map[string]string{"198.51.100.1:80": "192.168.1.10"}, "192.168.1.10", "wlan0"},
+		{map[string]string{"[2001:db8::1]:80": "2001:db8::10"}, "2001:db8::10", "eth0"},
+		{map[string]string{"198.51.100.1:80": "10.8.0.2"}, "192.168.1.10", "wlan0"},
+		{map[string]string{}, "192.168.1.10", "wlan0"},
+	}
+
+	for _, c := range cases {
+		routes = c.routes
+		var host, err = DetectHostIP("")
+
+		if err != nil || host.IP.String() != c.ip || host.Interface != c.iface {
+			t.Errorf("Expected %v on %v for routes %v, got %v, %v instead",
+				c.ip, c.iface, c.routes, host, err)
+		}
+	}
+
+	routes = map[string]string{"198.51.100.1:80": "10.8.0.2"}
+
+	if host, _ := DetectHostIP(""); !strings.Contains(host.Reason, "tun0") {
+		t.Errorf("Expected reason to mention the skipped interface, got %q instead", host.Reason)
+	}
+
+	ifaces = ifaces[:3]
+
+	if _, err := DetectHostIP(""); err != ErrHostNotFound {
+		t.Errorf("Expected host not found error, got %v instead", err)
+	}
+
+	if host, err := DetectHostIP("10.0.0.5"); err != nil || host.IP.String() != "10.0.0.5" {
+		t.Errorf("Expected override to be used, got %v, %v instead", host, err)
+	}
+
+	if _, err := DetectHostIP("localhost"); err != ErrInvalidHostIP {
+		t.Errorf("Expected invalid host IP error, got %v instead", err)
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	var r, err = ParseResources("2g", "1.5", []string{"FOO=bar"},
+		[]string{"/home/me/data:/data:ro", `C:\data:/data`}, "wedeploy")
+
+	if err != nil {
+		t.Errorf("Expected resources to be parsed, got %v instead", err)
+	}
+
+	if r.Memory != 2<<30 || r.CPUs != 1.5 || r.Network != "wedeploy" {
+		t.Errorf("Unexpected resources %+v", r)
+	}
+
+	var invalid = []struct {
+		memory  string
+		cpus    string
+		env     []string
+		volumes []string
+		network string
+	}{
+		{memory: "2x"},
+		{memory: "1k"},
+		{cpus: "-1"},
+		{cpus: "many"},
+		{env: []string{"=bar"}},
+		{volumes: []string{"/data"}},
+		{volumes: []string{"/home/me/data:data"}},
+		{volumes: []string{"/home/me/data:/data:rx"}},
+		{network: "my network"},
+	}
+
+	for _, c := range invalid {
+		if _, err = ParseResources(c.memory, c.cpus, c.env, c.volumes, c.network); err == nil {
+			t.Errorf("Expected %+v to be invalid", c)
+		} else if _, ok := err.(InvalidOptionError); !ok {
+			t.Errorf("Expected invalid option error, got %v instead", err)
+		}
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	var cases = map[string]string{
+		"2g":      "2g",
+		"2048m":   "2g",
+		"1536m":   "1536m",
+		"5000000": "5000000",
+		"4097k":   "4097k",
+	}
+
+	for s, want := range cases {
+		var m, err = ParseMemory(s)
+
+		if got := FormatMemory(m); got != want || err != nil {
+			t.Errorf("Expected %v to be formatted as %v, got %v, %v instead", s, want, got, err)
+		}
+	}
+}
+
+func TestResourcesOptions(t *testing.T) {
+	var options = ContainerOptions{
+		Image: "wedeploy/local:latest",
+		Env:   []string{"WEDEPLOY_HOST_IP=10.0.0.1"},
+	}
+
+	Resources{
+		Memory:  1 << 30,
+		CPUs:    1.5,
+		Env:     []string{"FOO=bar"},
+		Volumes: []string{"/home/me/data:/data"},
+		Network: "wedeploy",
+	}.apply(&options)
+
+	var want = []string{
+		"run",
+		"-v", "/home/me/data:/data",
+		"--memory", "1g",
+		"--cpus", "1.5",
+		"--network", "wedeploy",
+		"-e", "WEDEPLOY_HOST_IP=10.0.0.1",
+		"-e", "FOO=bar",
+		"--detach",
+		"wedeploy/local:latest",
+	}
+
+	if got := options.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted args %v, got %v instead", want, got)
+	}
+
+	var body = createBody(options)
+	var wantHost = hostConfig{
+		Binds:        []string{"/home/me/data:/data"},
+		PortBindings: map[string][]portBinding{},
+		Memory:       1 << 30,
+		CPUPeriod:    100000,
+		CPUQuota:     150000,
+		NetworkMode:  "wedeploy",
+	}
+
+	if !reflect.DeepEqual(body.HostConfig, wantHost) {
+		t.Errorf("Wanted host config %+v, got %+v instead", wantHost, body.HostConfig)
+	}
+}
+
+func setupRun(docker *fakeDocker) func() {
+	var defaultCheckAPI = checkAPI
+	var defaultCheckPorts = checkPorts
+	var defaultReadyInterval = readyInterval
+
+	checkAPI = func() error {
+		return nil
+	}
+
+	checkPorts = func(ports []PortBinding) []PortConflict {
+		return nil
+	}
+
+	readyInterval = time.Millisecond
+
+	return func() {
+		checkAPI = defaultCheckAPI
+		checkPorts = defaultCheckPorts
+		readyInterval = defaultReadyInterval
+	}
+}
+
+func TestRunDetached(t *testing.T) {
+	var docker = newFakeDocker()
+	defer setupRun(docker)()
+
+	var err = Run(context.Background(), docker, Flags{
+		Detach: true,
+		HostIP: "10.0.0.1",
+		Memory: "2g",
+	})
+
+	if err != nil {
+		t.Errorf("Expected run to succeed, got %v instead", err)
+	}
+
+	if !docker.images[WeDeployImage] {
+		t.Errorf("Expected image to be pulled")
+	}
+
+	if len(docker.started) != 1 || len(docker.running) != 1 {
+		t.Fatalf("Expected infrastructure container to start, got %v instead", docker.started)
+	}
+
+	var options = docker.started[0]
+
+	if options.Labels[Label] != "true" || options.Memory != 2<<30 ||
+		options.Env[0] != "WEDEPLOY_HOST_IP=10.0.0.1" {
+		t.Errorf("Unexpected container options %+v", options)
+	}
+
+	if err = Stop(docker); err != nil || len(docker.running) != 0 {
+		t.Errorf("Expected infrastructure to stop, got %v instead", err)
+	}
+
+	if err = Stop(docker); err != ErrNotRunning {
+		t.Errorf("Expected not running error, got %v instead", err)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	var docker = newFakeDocker()
+	defer setupRun(docker)()
+
+	var dm, err = New(docker, Flags{
+		DryRun: true,
+		HostIP: "10.0.0.1",
+	})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v instead", err)
+	}
+
+	var stdout bytes.Buffer
+	dm.Stdout = &stdout
+
+	if err = dm.Run(context.Background()); err != nil ||
+		len(docker.started) != 0 || docker.images[WeDeployImage] {
+		t.Errorf("Expected dry run to do nothing, got %v, %v instead", err, docker.started)
+	}
+
+	if !strings.Contains(stdout.String(), "WEDEPLOY_HOST_IP: 10.0.0.1") {
+		t.Errorf("Expected dry run to print the host IP, got %v instead", stdout.String())
+	}
 }
 
-func TestExistsDependency(t *testing.T) {
-	for _, c := range ExistsDependencyCases {
-		exists := existsDependency(c.cmd)
+func TestRunErrors(t *testing.T) {
+	var docker = newFakeDocker()
+	defer setupRun(docker)()
+
+	if err := Run(context.Background(), docker, Flags{ViewMode: true}); err != ErrNotRunning {
+		t.Errorf("Expected not running error, got %v instead", err)
+	}
+
+	if err := Run(context.Background(), docker, Flags{Ports: []string{"x"}}); err == nil {
+		t.Errorf("Expected invalid port error")
+	}
+
+	docker.pullErr = errors.New("network unreachable")
+	var err = Run(context.Background(), docker, Flags{HostIP: "10.0.0.1"})
+
+	if pe, ok := err.(PullError); !ok || pe.Image != WeDeployImage || pe.Err != docker.pullErr {
+		t.Errorf("Expected pull error, got %v instead", err)
+	}
+
+	docker.pullErr = nil
+
+	checkPorts = func(ports []PortBinding) []PortConflict {
+		return []PortConflict{{Port: ports[0]}}
+	}
+
+	if _, ok := Run(context.Background(), docker, Flags{HostIP: "10.0.0.1"}).(PortConflictsError); !ok {
+		t.Errorf("Expected port conflicts error")
+	}
 
-		if exists != c.find {
-			t.Errorf("existsDependency(%v) should return %v", c.cmd, c.find)
+	docker.running = []string{"container-0"}
+
+	if err = Run(context.Background(), docker, Flags{Fresh: true}); err != ErrAlreadyRunning {
+		t.Errorf("Expected already running error, got %v instead", err)
+	}
+
+	if len(docker.started) != 0 {
+		t.Errorf("Expected no container to start, got %v instead", docker.started)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	var docker = newFakeDocker()
+	defer setupRun(docker)()
+
+	docker.waiting = make(chan bool)
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	var done = make(chan error, 1)
+
+	go func() {
+		done <- Run(ctx, docker, Flags{HostIP: "10.0.0.1"})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected run to end cleanly, got %v instead", err)
 		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected run to end after cancellation")
+	}
+
+	if len(docker.stopped) != 1 || len(docker.running) != 0 {
+		t.Errorf("Expected infrastructure to be stopped, got %v instead", docker.stopped)
 	}
 }
@@ -3,17 +3,17 @@
 package run
 
 import (
-	"os"
+	"errors"
+	"os/exec"
 	"syscall"
 )
 
-func runWait(container string) (*os.Process, error) {
-	return os.StartProcess(getDockerPath(),
-		[]string{bin, "wait", container},
-		&os.ProcAttr{
-			Sys: &syscall.SysProcAttr{
-				Setpgid: true,
-			},
-			Files: []*os.File{nil, nil, nil},
-		})
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
 }
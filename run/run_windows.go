@@ -2,12 +2,17 @@
 
 package run
 
-import "os"
-
-func runWait(container string) (*os.Process, error) {
-	return os.StartProcess(getDockerPath(),
-		[]string{bin, "wait", container},
-		&os.ProcAttr{
-			Files: []*os.File{nil, nil, nil},
-		})
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func detachProcessGroup(cmd *exec.Cmd) {}
+
+// wsaeaddrinuse is the Windows Sockets "address already in use" error
+const wsaeaddrinuse = syscall.Errno(10048)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse)
 }
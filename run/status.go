@@ -0,0 +1,131 @@
+package run
+
+import (
+	"net"
+	"time"
+
+	"github.com/wedeploy/cli/projects"
+)
+
+// Status of the infrastructure
+type Status struct {
+	Running   bool
+	Container ContainerInfo
+	Image     ImageInfo
+	Services  []ServiceStatus
+	APIError  error
+}
+
+// ServiceStatus is the health of an internal service of the infrastructure
+type ServiceStatus struct {
+	Name string
+	Port PortBinding
+	Up   bool
+}
+
+var serviceNames = map[string]string{
+	"80":    "web",
+	"5005":  "debugger",
+	"8080":  "api",
+	"8500":  "consul",
+	"9200":  "elasticsearch",
+	"24224": "fluentd",
+}
+
+// DialTimeout is how long to wait when checking if a service is up
+var DialTimeout = time.Second
+
+// checkAPI checks if the API answers; replaced on tests
+var checkAPI = func() error {
+	var _, err = projects.List()
+	return err
+}
+
+// Ready tells if the infrastructure is running and the API answers
+func (s Status) Ready() bool {
+	return s.Running && s.APIError == nil
+}
+
+// Uptime of the infrastructure
+func (s Status) Uptime(now time.Time) time.Duration {
+	if !s.Running {
+		return 0
+	}
+
+	return now.Sub(s.Container.StartedAt)
+}
+
+// GetStatus gets the status of the infrastructure
+func GetStatus(docker Docker) (Status, error) {
+	var status Status
+	var ids, err = docker.ListContainers(Label, false)
+
+	if err != nil || len(ids) == 0 {
+		return status, err
+	}
+
+	if status.Container, err = docker.InspectContainer(ids[0]); err != nil {
+		return status, err
+	}
+
+	status.Running = status.Container.Running
+
+	if status.Image, err = docker.InspectImage(status.Container.ImageID); err != nil {
+		return status, err
+	}
+
+	status.Services = checkServices(status.Container.Ports)
+	status.APIError = checkAPI()
+	return status, nil
+}
+
+// WaitReady waits until the infrastructure is ready or the timeout is reached
+func WaitReady(docker Docker, timeout, interval time.Duration) (Status, error) {
+	var deadline = time.Now().Add(timeout)
+
+	for {
+		var status, err = GetStatus(docker)
+
+		if err != nil || status.Ready() || time.Now().Add(interval).After(deadline) {
+			return status, err
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func checkServices(ports []PortBinding) []ServiceStatus {
+	var services = []ServiceStatus{}
+
+	for _, p := range ports {
+		// UDP can't be checked without speaking the protocol
+		if p.protocol() != "tcp" {
+			continue
+		}
+
+		var name, ok = serviceNames[p.Container]
+
+		if !ok {
+			name = "port " + p.Container
+		}
+
+		services = append(services, ServiceStatus{
+			Name: name,
+			Port: p,
+			Up:   isListening(p.Host),
+		})
+	}
+
+	return services
+}
+
+func isListening(port string) bool {
+	var conn, err = net.DialTimeout("tcp", net.JoinHostPort("localhost", port), DialTimeout)
+
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+	return true
+}
@@ -0,0 +1,198 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/wedeploy/cli/user"
+	"github.com/wedeploy/cli/verbose"
+)
+
+// Volume for the data of the infrastructure
+type Volume struct {
+	Name string
+	Path string
+}
+
+// Volumes keeping the data of the infrastructure between runs
+var Volumes = []Volume{
+	{"wedeploy-local-data", "/data"},
+}
+
+// SnapshotImage is the docker image used to save and restore snapshots
+var SnapshotImage = "busybox:latest"
+
+var (
+	// ErrSnapshotNotFound is used when restoring a snapshot that doesn't exist
+	ErrSnapshotNotFound = errors.New("Snapshot not found")
+
+	// ErrInvalidSnapshotName is used when a snapshot name can't be used as a file name
+	ErrInvalidSnapshotName = errors.New("Invalid snapshot name: use letters, digits, '.', '_' or '-'")
+
+	snapshotNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+const volumesMount = "/volumes"
+
+// SnapshotsDir is where the snapshots are stored
+func SnapshotsDir() string {
+	return filepath.Join(user.GetHomeDir(), ".wedeploy", "snapshots")
+}
+
+// SnapshotPath gets the file of a snapshot
+func SnapshotPath(name string) string {
+	return filepath.Join(SnapshotsDir(), name+".tar.gz")
+}
+
+func (v Volume) bind(readOnly bool) string {
+	var bind = v.Name + ":" + volumesMount + "/" + v.Name
+
+	if readOnly {
+		bind += ":ro"
+	}
+
+	return bind
+}
+
+func (v Volume) String() string {
+	return v.Name + ":" + v.Path
+}
+
+// Reset removes the data of the infrastructure
+func Reset(docker Docker) error {
+	if err := checkStopped(docker); err != nil {
+		return err
+	}
+
+	// stopped containers still use the volumes
+	var ids, err = docker.ListContainers(Label, true)
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		verbose.Debug("Removing container", id)
+
+		if err = docker.RemoveContainer(id); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range Volumes {
+		verbose.Debug("Removing volume", v.Name)
+
+		if err = docker.RemoveVolume(v.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveSnapshot saves the data of the infrastructure as a tarball
+func SaveSnapshot(docker Docker, name string) (string, error) {
+	if !snapshotNameRegex.MatchString(name) {
+		return "", ErrInvalidSnapshotName
+	}
+
+	if err := checkStopped(docker); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(SnapshotsDir(), 0700); err != nil {
+		return "", err
+	}
+
+	var binds = []string{SnapshotsDir() + ":/snapshots"}
+
+	for _, v := range Volumes {
+		binds = append(binds, v.bind(true))
+	}
+
+	var err = runTask(docker, ContainerOptions{
+		Image: SnapshotImage,
+		Cmd:   []string{"tar", "czf", "/snapshots/" + name + ".tar.gz", "-C", volumesMount, "."},
+		Binds: binds,
+	})
+
+	return SnapshotPath(name), err
+}
+
+// RestoreSnapshot replaces the data of the infrastructure by a snapshot
+func RestoreSnapshot(docker Docker, name string) error {
+	if !snapshotNameRegex.MatchString(name) {
+		return ErrInvalidSnapshotName
+	}
+
+	if _, err := os.Stat(SnapshotPath(name)); os.IsNotExist(err) {
+		return ErrSnapshotNotFound
+	}
+
+	if err := Reset(docker); err != nil {
+		return err
+	}
+
+	var binds = []string{SnapshotsDir() + ":/snapshots:ro"}
+
+	for _, v := range Volumes {
+		binds = append(binds, v.bind(false))
+	}
+
+	return runTask(docker, ContainerOptions{
+		Image: SnapshotImage,
+		Cmd:   []string{"tar", "xzf", "/snapshots/" + name + ".tar.gz", "-C", volumesMount},
+		Binds: binds,
+	})
+}
+
+func checkStopped(docker Docker) error {
+	var ids, err = docker.ListContainers(Label, false)
+
+	if err != nil {
+		return err
+	}
+
+	if len(ids) != 0 {
+		return ErrAlreadyRunning
+	}
+
+	return nil
+}
+
+// runTask runs a helper container until it exits, and removes it
+func runTask(docker Docker, options ContainerOptions) error {
+	var has, err = docker.HasImage(options.Image)
+
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		if err = docker.Pull(options.Image, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	var id string
+
+	if id, err = docker.Start(options); err != nil {
+		return err
+	}
+
+	var code int
+	code, err = docker.Wait(id)
+
+	if rerr := docker.RemoveContainer(id); rerr != nil {
+		verbose.Debug("Error removing helper container", id+":", rerr)
+	}
+
+	if err == nil && code != 0 {
+		err = fmt.Errorf("%v exited with status %d", options.Cmd[0], code)
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package schema
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Version of the definitions schemas
+const Version = "v1"
+
+var definitions = map[string]string{
+	"project/v1":   projectV1,
+	"container/v1": containerV1,
+}
+
+var (
+	decoded      = map[string]*Schema{}
+	decodedMutex sync.Mutex
+)
+
+// Get a schema by name and version, such as container/v1
+func Get(name string) (*Schema, bool) {
+	decodedMutex.Lock()
+	defer decodedMutex.Unlock()
+
+	if s, ok := decoded[name]; ok {
+		return s, true
+	}
+
+	var raw, ok = definitions[name]
+
+	if !ok {
+		return nil, false
+	}
+
+	var s = &Schema{}
+
+	if err := json.Unmarshal([]byte(raw), s); err != nil {
+		panic(err)
+	}
+
+	decoded[name] = s
+	return s, true
+}
+
+// Raw gets the JSON of a schema by name and version
+func Raw(name string) (string, bool) {
+	var raw, ok = definitions[name]
+	return raw, ok
+}
+
+// Project is the schema of project.json
+func Project() *Schema {
+	var s, _ = Get("project/" + Version)
+	return s
+}
+
+// Container is the schema of container.json
+func Container() *Schema {
+	var s, _ = Get("container/" + Version)
+	return s
+}
+
+const projectV1 = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "$id": "https://wedeploy.com/schemas/v1/project.json",
+    "title": "WeDeploy project",
+    "type": "object",
+    "required": ["id"],
+    "additionalProperties": false,
+    "properties": {
+        "$schema": {"type": "string"},
+        "id": {"type": "string", "minLength": 1},
+        "name": {"type": "string"},
+        "domain": {"type": "string"},
+        "state": {"type": "string"},
+        "description": {"type": "string"}
+    }
+}`
+
+const containerV1 = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "$id": "https://wedeploy.com/schemas/v1/container.json",
+    "title": "WeDeploy container",
+    "type": "object",
+    "required": ["id"],
+    "additionalProperties": false,
+    "properties": {
+        "$schema": {"type": "string"},
+        "id": {"type": "string", "minLength": 1},
+        "name": {"type": "string"},
+        "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+        "state": {"type": "string"},
+        "type": {"type": "string"},
+        "hooks": {
+            "type": "object",
+            "additionalProperties": false,
+            "properties": {
+                "before_build": {"type": "string"},
+                "build": {"type": "string"},
+                "after_build": {"type": "string"},
+                "before_deploy": {"type": "string"},
+                "deploy": {"type": "string"},
+                "after_deploy": {"type": "string"}
+            }
+        },
+        "deploy_ignore": {"type": "array", "items": {"type": "string"}},
+        "env": {"type": "object", "additionalProperties": {"type": "string"}},
+        "instances": {"type": "integer", "minimum": 1},
+        "depends_on": {"type": "array", "items": {"type": "string", "minLength": 1}}
+    }
+}`
+
+// ValidateProject validates the definition of a project
+// and the definition of every container on it, with their overlays.
+func ValidateProject(root string) ([]Problem, error) {
+	var problems, err = validateDefinition(root, "project", Project())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+
+	if files, err = ioutil.ReadDir(root); err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+
+		var cp []Problem
+
+		cp, err = validateDefinition(filepath.Join(root, f.Name()), "container", Container())
+
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		problems = append(problems, cp...)
+	}
+
+	return problems, nil
+}
+
+func validateDefinition(dir, name string, s *Schema) ([]Problem, error) {
+	var file, err = Find(dir, name)
+
+	if me, ok := err.(MultipleDefinitionsError); ok {
+		return []Problem{{
+			File:    dir,
+			Message: me.Error(),
+		}}, nil
+	}
+
+	var problems []Problem
+
+	if err == nil {
+		problems, err = ValidateFile(file, s)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var overlays []string
+
+	if overlays, err = Overlays(file); err != nil {
+		return nil, err
+	}
+
+	for _, o := range overlays {
+		var op []Problem
+
+		if op, err = ValidateOverlay(o, s); err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, op...)
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,277 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Extensions of the definition files, by order of preference
+var Extensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// MultipleDefinitionsError is used when a directory has more than one definition
+// of the same kind, such as container.json and container.yaml
+type MultipleDefinitionsError struct {
+	Dir   string
+	Files []string
+}
+
+func (m MultipleDefinitionsError) Error() string {
+	return fmt.Sprintf("Multiple definitions found on %v: %v",
+		m.Dir, strings.Join(m.Files, ", "))
+}
+
+// Files gets the accepted file names of a definition, such as container.yaml
+func Files(name string) []string {
+	var files = []string{}
+
+	for _, ext := range Extensions {
+		files = append(files, name+ext)
+	}
+
+	return files
+}
+
+// Find the definition file of a directory, such as its container.json or container.yaml
+// The error satisfies os.IsNotExist when there is no definition.
+func Find(dir, name string) (string, error) {
+	var found = []string{}
+
+	for _, file := range Files(name) {
+		if stat, err := os.Stat(filepath.Join(dir, file)); err == nil && !stat.IsDir() {
+			found = append(found, file)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", &os.PathError{
+			Op:   "find",
+			Path: filepath.Join(dir, name+".json"),
+			Err:  os.ErrNotExist,
+		}
+	case 1:
+		return filepath.Join(dir, found[0]), nil
+	}
+
+	return "", MultipleDefinitionsError{dir, found}
+}
+
+// FindDefinition finds the container or project definition of a path,
+// which might be the definition file itself
+func FindDefinition(path string) (string, error) {
+	var stat, err = os.Stat(path)
+
+	if err != nil || !stat.IsDir() {
+		return path, err
+	}
+
+	var file string
+
+	if file, err = Find(path, "container"); os.IsNotExist(err) {
+		file, err = Find(path, "project")
+	}
+
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no project or container definition found on %v", path)
+	}
+
+	return file, err
+}
+
+var formatExtensions = map[string]string{
+	"json": ".json",
+	"yaml": ".yaml",
+	"yml":  ".yml",
+	"toml": ".toml",
+}
+
+// Extension of a format given by name, such as .yaml for yaml
+func Extension(format string) (string, bool) {
+	var ext, ok = formatExtensions[format]
+	return ext, ok
+}
+
+// Format of a file, by its extension: JSON, YAML or TOML
+func Format(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".toml":
+		return "TOML"
+	}
+
+	return "JSON"
+}
+
+// ParseFile parses a definition on any of the supported formats
+func ParseFile(file string, data []byte) (*Node, error) {
+	switch Format(file) {
+	case "YAML":
+		return ParseYAML(data)
+	case "TOML":
+		return ParseTOML(data)
+	}
+
+	return Parse(data)
+}
+
+// Encode a node on the format of the given file name
+func Encode(file string, n *Node) ([]byte, error) {
+	switch Format(file) {
+	case "YAML":
+		return EncodeYAML(n)
+	case "TOML":
+		return EncodeTOML(n)
+	}
+
+	var buf bytes.Buffer
+	var raw, err = n.MarshalJSON()
+
+	if err == nil {
+		err = json.Indent(&buf, raw, "", "    ")
+	}
+
+	buf.WriteString("\n")
+	return buf.Bytes(), err
+}
+
+// DecodeFile reads a definition file of any of the supported formats as JSON
+func DecodeFile(file string) ([]byte, error) {
+	var content, err = ioutil.ReadFile(file)
+
+	if err != nil || Format(file) == "JSON" {
+		return content, err
+	}
+
+	var n *Node
+
+	if n, err = ParseFile(file, content); err != nil {
+		return nil, fmt.Errorf("%v:%v", file, err)
+	}
+
+	return n.MarshalJSON()
+}
+
+// Convert a definition file to the format of the given extension, such as .yaml
+// It returns the path and content of the converted definition, without writing it.
+// The values of the converted definition are checked to be the same as the original's.
+func Convert(file, ext string) (string, []byte, error) {
+	var content, err = ioutil.ReadFile(file)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	var n *Node
+
+	if n, err = ParseFile(file, content); err != nil {
+		return "", nil, fmt.Errorf("%v:%v", file, err)
+	}
+
+	var dest = strings.TrimSuffix(file, filepath.Ext(file)) + ext
+	var out []byte
+
+	if out, err = Encode(dest, n); err != nil {
+		return "", nil, err
+	}
+
+	if !sameValues(n, dest, out) {
+		return "", nil, fmt.Errorf("converting %v to %v would lose data", file, Format(dest))
+	}
+
+	return dest, out, nil
+}
+
+func sameValues(n *Node, file string, content []byte) bool {
+	var c, err = ParseFile(file, content)
+
+	if err != nil {
+		return false
+	}
+
+	var a, b interface{}
+	var ja, _ = n.MarshalJSON()
+	var jb, _ = c.MarshalJSON()
+
+	return json.Unmarshal(ja, &a) == nil &&
+		json.Unmarshal(jb, &b) == nil &&
+		reflect.DeepEqual(a, b)
+}
+
+// MarshalJSON encodes the node as JSON, keeping the order of the keys
+func (n *Node) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch n.Kind {
+	case Object:
+		buf.WriteString("{")
+
+		for i, k := range n.Keys {
+			if i != 0 {
+				buf.WriteString(",")
+			}
+
+			var key = quote(k.Name)
+			var value, err = k.Value.MarshalJSON()
+
+			if err != nil {
+				return nil, err
+			}
+
+			buf.WriteString(key)
+			buf.WriteString(":")
+			buf.Write(value)
+		}
+
+		buf.WriteString("}")
+	case Array:
+		buf.WriteString("[")
+
+		for i, item := range n.Items {
+			if i != 0 {
+				buf.WriteString(",")
+			}
+
+			var value, err = item.MarshalJSON()
+
+			if err != nil {
+				return nil, err
+			}
+
+			buf.Write(value)
+		}
+
+		buf.WriteString("]")
+	case String:
+		return []byte(quote(n.String)), nil
+	case Number:
+		return []byte(n.Raw), nil
+	case Bool:
+		return json.Marshal(n.Bool)
+	default:
+		return []byte("null"), nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// quote a string as JSON, without escaping HTML characters
+// TOML basic strings have the same escapes.
+func quote(s string) string {
+	var buf bytes.Buffer
+	var encoder = json.NewEncoder(&buf)
+
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(s); err != nil {
+		panic(err)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,327 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Kind of a JSON value
+type Kind int
+
+// JSON value kinds
+const (
+	Null Kind = iota
+	Bool
+	Number
+	String
+	Array
+	Object
+)
+
+var kindNames = map[Kind]string{
+	Null:   "null",
+	Bool:   "boolean",
+	Number: "number",
+	String: "string",
+	Array:  "array",
+	Object: "object",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Position on a file (1-based)
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Node is a JSON value and where it is on the file
+type Node struct {
+	Kind     Kind
+	Position Position
+	Bool     bool
+	Number   float64
+	Raw      string
+	String   string
+	Items    []*Node
+	Keys     []*Key
+}
+
+// Key of an object, with its position
+type Key struct {
+	Name     string
+	Position Position
+	Value    *Node
+}
+
+// SyntaxError is used when the content isn't valid JSON
+type SyntaxError struct {
+	Position Position
+	Msg      string
+}
+
+func (s SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", s.Position.Line, s.Position.Column, s.Msg)
+}
+
+// Get the value of an object key
+func (n *Node) Get(name string) *Node {
+	for _, k := range n.Keys {
+		if k.Name == name {
+			return k.Value
+		}
+	}
+
+	return nil
+}
+
+type parser struct {
+	data   []byte
+	offset int
+	line   int
+	column int
+}
+
+// Parse JSON keeping the position of its values
+func Parse(data []byte) (*Node, error) {
+	var p = &parser{data: data, line: 1, column: 1}
+	var n, err = p.value()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.space()
+
+	if p.offset != len(p.data) {
+		return nil, p.errorf("unexpected %q after the end of the value", p.peek())
+	}
+
+	return n, nil
+}
+
+func (p *parser) position() Position {
+	return Position{p.line, p.column}
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return SyntaxError{p.position(), fmt.Sprintf(format, a...)}
+}
+
+func (p *parser) peek() byte {
+	if p.offset >= len(p.data) {
+		return 0
+	}
+
+	return p.data[p.offset]
+}
+
+func (p *parser) next() byte {
+	var c = p.data[p.offset]
+	p.offset++
+
+	switch {
+	case c == '\n':
+		p.line++
+		p.column = 1
+	case c < utf8.RuneSelf || utf8.RuneStart(c):
+		p.column++
+	}
+
+	return c
+}
+
+func (p *parser) space() {
+	for p.offset < len(p.data) {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) value() (*Node, error) {
+	p.space()
+
+	var n = &Node{Position: p.position()}
+
+	switch c := p.peek(); {
+	case c == '{':
+		n.Kind = Object
+		return n, p.object(n)
+	case c == '[':
+		n.Kind = Array
+		return n, p.array(n)
+	case c == '"':
+		var s, err = p.string()
+		n.Kind, n.String = String, s
+		return n, err
+	case c == '-' || (c >= '0' && c <= '9'):
+		n.Kind = Number
+		return n, p.number(n)
+	case c == 0:
+		return nil, p.errorf("unexpected end of JSON")
+	}
+
+	for word, kind := range map[string]Kind{"true": Bool, "false": Bool, "null": Null} {
+		if p.offset+len(word) <= len(p.data) && string(p.data[p.offset:p.offset+len(word)]) == word {
+			for range word {
+				p.next()
+			}
+
+			n.Kind, n.Bool = kind, word == "true"
+			return n, nil
+		}
+	}
+
+	return nil, p.errorf("invalid character %q looking for a value", p.peek())
+}
+
+func (p *parser) object(n *Node) error {
+	p.next()
+	p.space()
+
+	if p.peek() == '}' {
+		p.next()
+		return nil
+	}
+
+	for {
+		p.space()
+
+		if p.peek() != '"' {
+			return p.errorf("expected a string for an object key")
+		}
+
+		var k = &Key{Position: p.position()}
+		var err error
+
+		if k.Name, err = p.string(); err != nil {
+			return err
+		}
+
+		if n.Get(k.Name) != nil {
+			return SyntaxError{k.Position, fmt.Sprintf("key %q is already defined", k.Name)}
+		}
+
+		p.space()
+
+		if p.peek() != ':' {
+			return p.errorf("expected ':' after object key")
+		}
+
+		p.next()
+
+		if k.Value, err = p.value(); err != nil {
+			return err
+		}
+
+		n.Keys = append(n.Keys, k)
+		p.space()
+
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			return nil
+		default:
+			return p.errorf("expected ',' or '}' after object value")
+		}
+	}
+}
+
+func (p *parser) array(n *Node) error {
+	p.next()
+	p.space()
+
+	if p.peek() == ']' {
+		p.next()
+		return nil
+	}
+
+	for {
+		var item, err = p.value()
+
+		if err != nil {
+			return err
+		}
+
+		n.Items = append(n.Items, item)
+		p.space()
+
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+			p.next()
+			return nil
+		default:
+			return p.errorf("expected ',' or ']' after array value")
+		}
+	}
+}
+
+func (p *parser) string() (string, error) {
+	var start = p.offset
+	p.next()
+
+	for {
+		switch c := p.peek(); {
+		case c == 0 && p.offset >= len(p.data):
+			return "", p.errorf("unexpected end of JSON in string")
+		case c == '\\':
+			p.next()
+
+			if p.offset >= len(p.data) {
+				return "", p.errorf("unexpected end of JSON in string")
+			}
+
+			p.next()
+		case c == '"':
+			p.next()
+			var s string
+
+			if err := json.Unmarshal(p.data[start:p.offset], &s); err != nil {
+				return "", SyntaxError{p.position(), "invalid string escape"}
+			}
+
+			return s, nil
+		case c < 0x20:
+			return "", p.errorf("invalid control character in string")
+		default:
+			p.next()
+		}
+	}
+}
+
+func (p *parser) number(n *Node) error {
+	var start = p.offset
+
+	for p.offset < len(p.data) {
+		var c = p.peek()
+
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+
+		p.next()
+	}
+
+	n.Raw = string(p.data[start:p.offset])
+
+	var f, err = strconv.ParseFloat(n.Raw, 64)
+
+	if err != nil {
+		return SyntaxError{n.Position, "invalid number " + n.Raw}
+	}
+
+	n.Number = f
+	return nil
+}
@@ -0,0 +1,227 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Environment selects the overlay merged over the definitions,
+	// such as container.production.json for production
+	Environment string
+
+	// Vars used on ${VAR} interpolation when not set on the process environment
+	Vars = map[string]string{}
+)
+
+// EnvironmentPattern for the names of the environments
+var EnvironmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var variablePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ReadFile reads a definition file as JSON, resolving it:
+// the overlay of the Environment is merged over it
+// and ${VAR} variables on its strings (but the hooks) are interpolated.
+// Variables that aren't set and have no default are kept as written:
+// Check warns about them.
+func ReadFile(file string) ([]byte, error) {
+	var n, err = Resolve(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return n.MarshalJSON()
+}
+
+// Resolve reads a definition file as a node, resolving it as ReadFile does
+func Resolve(file string) (*Node, error) {
+	var n, err = parseDefinition(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var overlay string
+
+	switch overlay, err = FindOverlay(file, Environment); {
+	case os.IsNotExist(err):
+		return n, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var o *Node
+
+	if o, err = parseDefinition(overlay); err != nil {
+		return nil, err
+	}
+
+	return Merge(n, o), nil
+}
+
+func parseDefinition(file string) (*Node, error) {
+	var content, err = ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the errors of encoding/json for JSON definitions
+	if Format(file) == "JSON" {
+		var raw json.RawMessage
+
+		if err = json.Unmarshal(content, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	var n *Node
+
+	if n, err = ParseFile(file, content); err != nil {
+		return nil, fmt.Errorf("%v:%v", file, err)
+	}
+
+	interpolateDefinition(n)
+	return n, nil
+}
+
+// interpolateDefinition interpolates the variables of a definition,
+// except on its hooks, which are shell commands with their own variables
+func interpolateDefinition(n *Node) {
+	if n.Kind != Object {
+		Interpolate(n)
+		return
+	}
+
+	for _, k := range n.Keys {
+		if k.Name != "hooks" {
+			Interpolate(k.Value)
+		}
+	}
+}
+
+// FindOverlay finds the overlay of a definition file for an environment,
+// such as container.production.yaml for container.json
+func FindOverlay(file, environment string) (string, error) {
+	if environment == "" {
+		return "", &os.PathError{Op: "find", Path: file, Err: os.ErrNotExist}
+	}
+
+	var base = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return Find(filepath.Dir(file), base+"."+environment)
+}
+
+// Overlays finds the overlays of a definition file for all environments
+func Overlays(file string) ([]string, error) {
+	var base = strings.TrimSuffix(file, filepath.Ext(file))
+	var overlays = []string{}
+
+	for _, ext := range Extensions {
+		var matches, err = filepath.Glob(base + ".*" + ext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			var env = strings.TrimSuffix(strings.TrimPrefix(m, base+"."), ext)
+
+			if EnvironmentPattern.MatchString(env) {
+				overlays = append(overlays, m)
+			}
+		}
+	}
+
+	return overlays, nil
+}
+
+// Merge an overlay over a node, as a JSON merge patch (RFC 7396):
+// objects are merged, null values remove keys and other values replace the original.
+func Merge(n, overlay *Node) *Node {
+	if n.Kind != Object || overlay.Kind != Object {
+		return overlay
+	}
+
+	var merged = &Node{Kind: Object, Position: n.Position}
+
+	for _, k := range n.Keys {
+		var o = overlay.Get(k.Name)
+
+		switch {
+		case o == nil:
+			merged.Keys = append(merged.Keys, k)
+		case o.Kind != Null:
+			merged.Keys = append(merged.Keys, &Key{k.Name, k.Position, Merge(k.Value, o)})
+		}
+	}
+
+	for _, k := range overlay.Keys {
+		if n.Get(k.Name) == nil && k.Value.Kind != Null {
+			merged.Keys = append(merged.Keys, &Key{k.Name, k.Position, Merge(&Node{Kind: Object}, k.Value)})
+		}
+	}
+
+	return merged
+}
+
+// Interpolate the ${VAR} and ${VAR:-default} variables of the strings of a node
+// Variables are read from the process environment, then from Vars. $$ is a literal $.
+// Variables that aren't set and have no default are kept as written.
+func Interpolate(n *Node) {
+	switch n.Kind {
+	case String:
+		n.String = variablePattern.ReplaceAllStringFunc(n.String, interpolateVariable)
+	case Array:
+		for _, item := range n.Items {
+			Interpolate(item)
+		}
+	case Object:
+		for _, k := range n.Keys {
+			Interpolate(k.Value)
+		}
+	}
+}
+
+func interpolateVariable(s string) string {
+	if s == "$$" {
+		return "$"
+	}
+
+	var m = variablePattern.FindStringSubmatch(s)
+	var value, ok = lookupVariable(m[1])
+
+	switch {
+	case ok:
+		return value
+	case m[2] != "":
+		return m[3]
+	}
+
+	return s
+}
+
+// HasVariables tells if a string has ${VAR} variables to be interpolated
+func HasVariables(s string) bool {
+	for _, m := range variablePattern.FindAllString(s, -1) {
+		if m != "$$" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lookupVariable(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+
+	var value, ok = Vars[name]
+	return value, ok
+}
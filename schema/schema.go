@@ -0,0 +1,452 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used for the definitions
+type Schema struct {
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            int                `json:"minLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// Problem found validating a definition
+// Warnings, such as unknown keys, don't stop a definition from being used.
+type Problem struct {
+	File     string
+	Position Position
+	Path     string
+	Message  string
+	Warning  bool
+}
+
+// ValidationError is used when a definition has errors
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (p Problem) String() string {
+	var level = "error"
+
+	if p.Warning {
+		level = "warning"
+	}
+
+	if p.Position.Line == 0 {
+		return fmt.Sprintf("%v: %v: %v", p.File, level, p.Message)
+	}
+
+	return fmt.Sprintf("%v:%d:%d: %v: %v", p.File,
+		p.Position.Line, p.Position.Column, level, p.Message)
+}
+
+func (v ValidationError) Error() string {
+	var lines = []string{}
+
+	for _, p := range v.Problems {
+		lines = append(lines, p.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Errors filters the problems that aren't warnings
+func Errors(problems []Problem) []Problem {
+	var errors = []Problem{}
+
+	for _, p := range problems {
+		if !p.Warning {
+			errors = append(errors, p)
+		}
+	}
+
+	return errors
+}
+
+// ValidateFile validates a definition file
+func ValidateFile(file string, s *Schema) ([]Problem, error) {
+	return validateFile(file, s, false)
+}
+
+// ValidateOverlay validates an overlay of a definition file
+// Required keys might be missing, and null values remove keys.
+func ValidateOverlay(file string, s *Schema) ([]Problem, error) {
+	return validateFile(file, s, true)
+}
+
+func validateFile(file string, s *Schema, overlay bool) ([]Problem, error) {
+	var content, err = ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return validate(file, content, s, overlay), nil
+}
+
+// Validate a definition, reporting the problems found on it
+func Validate(file string, content []byte, s *Schema) []Problem {
+	return validate(file, content, s, false)
+}
+
+func validate(file string, content []byte, s *Schema, overlay bool) []Problem {
+	var n, err = ParseFile(file, content)
+
+	if err != nil {
+		var pos Position
+
+		if se, ok := err.(SyntaxError); ok {
+			pos = se.Position
+			err = fmt.Errorf("%v", se.Msg)
+		}
+
+		return []Problem{{
+			File:     file,
+			Position: pos,
+			Message:  "invalid " + Format(file) + ": " + err.Error(),
+		}}
+	}
+
+	var v = &validator{file: file, overlay: overlay}
+	v.validate(n, s, "")
+	v.checkVariables(n, "")
+	return v.problems
+}
+
+// Check validates a definition and its overlay for the Environment, if any,
+// and returns its warnings, or a ValidationError if it has errors.
+func Check(file string, s *Schema) (warnings []Problem, err error) {
+	var problems []Problem
+
+	if problems, err = ValidateFile(file, s); err != nil {
+		return nil, err
+	}
+
+	var overlay, oerr = FindOverlay(file, Environment)
+
+	switch {
+	case oerr == nil:
+		var op []Problem
+
+		if op, err = ValidateOverlay(overlay, s); err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, op...)
+	case !os.IsNotExist(oerr):
+		return nil, oerr
+	}
+
+	if errors := Errors(problems); len(errors) != 0 {
+		return nil, ValidationError{problems}
+	}
+
+	return problems, nil
+}
+
+// CheckDir checks the definition of a directory, such as the container.json of a container,
+// writing its warnings, if any, to the given writer
+func CheckDir(dir, name string, s *Schema, warnings io.Writer) error {
+	var file, err = Find(dir, name)
+	var problems []Problem
+
+	if err == nil {
+		problems, err = Check(file, s)
+	}
+
+	if warnings != nil {
+		for _, p := range problems {
+			fmt.Fprintln(warnings, p)
+		}
+	}
+
+	return err
+}
+
+type validator struct {
+	file     string
+	overlay  bool
+	problems []Problem
+}
+
+func (v *validator) report(pos Position, path string, warning bool, format string, a ...interface{}) {
+	var msg = fmt.Sprintf(format, a...)
+
+	if path != "" {
+		msg = path + ": " + msg
+	}
+
+	v.problems = append(v.problems, Problem{
+		File:     v.file,
+		Position: pos,
+		Path:     path,
+		Message:  msg,
+		Warning:  warning,
+	})
+}
+
+func (v *validator) validate(n *Node, s *Schema, path string) {
+	if !v.validateType(n, s, path) {
+		return
+	}
+
+	switch n.Kind {
+	case Object:
+		v.validateObject(n, s, path)
+	case Array:
+		if s.Items != nil {
+			for i, item := range n.Items {
+				v.validate(item, s.Items, fmt.Sprintf("%v[%d]", path, i))
+			}
+		}
+	case Number:
+		v.validateNumber(n, s, path)
+	case String:
+		v.validateString(n, s, path)
+	}
+}
+
+func (v *validator) validateType(n *Node, s *Schema, path string) bool {
+	switch {
+	case v.overlay && n.Kind == Null:
+		return false
+	case s.Type == "":
+		return true
+	case s.Type == "integer" && n.Kind == Number && n.Number != math.Trunc(n.Number):
+		v.report(n.Position, path, false, "expected an integer, got %v", n.Raw)
+		return false
+	case s.Type == "integer" && n.Kind == Number:
+		return true
+	case s.Type != n.Kind.String():
+		v.report(n.Position, path, false, "expected %v, got %v", article(s.Type), article(n.Kind.String()))
+		return false
+	}
+
+	return true
+}
+
+func (v *validator) validateObject(n *Node, s *Schema, path string) {
+	var additional, closed = s.additional()
+
+	for _, k := range n.Keys {
+		var keyPath = joinPath(path, k.Name)
+
+		if ps, ok := s.Properties[k.Name]; ok {
+			v.validate(k.Value, ps, keyPath)
+			continue
+		}
+
+		if additional != nil {
+			v.validate(k.Value, additional, keyPath)
+			continue
+		}
+
+		if closed {
+			v.report(k.Position, "", true, "unknown key %q%v", keyPath, s.suggest(k.Name))
+		}
+	}
+
+	// overlays are merged over definitions that have the required keys
+	if v.overlay {
+		return
+	}
+
+	for _, r := range s.Required {
+		if n.Get(r) == nil {
+			v.report(n.Position, path, false, "missing required key %q", r)
+		}
+	}
+}
+
+func (v *validator) validateNumber(n *Node, s *Schema, path string) {
+	if s.Minimum != nil && n.Number < *s.Minimum {
+		v.report(n.Position, path, false, "%v is less than the minimum of %v", n.Raw, *s.Minimum)
+	}
+
+	if s.Maximum != nil && n.Number > *s.Maximum {
+		v.report(n.Position, path, false, "%v is more than the maximum of %v", n.Raw, *s.Maximum)
+	}
+}
+
+func (v *validator) validateString(n *Node, s *Schema, path string) {
+	switch {
+	case n.String == "" && s.MinLength == 1:
+		v.report(n.Position, path, false, "expected a non-empty string")
+	case len(n.String) < s.MinLength:
+		v.report(n.Position, path, false, "expected at least %d characters", s.MinLength)
+	}
+
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(n.String) {
+		v.report(n.Position, path, false, "%q doesn't match %v", n.String, s.Pattern)
+	}
+
+	if len(s.Enum) != 0 && !contains(s.Enum, n.String) {
+		v.report(n.Position, path, false, "%q isn't one of %v", n.String, strings.Join(s.Enum, ", "))
+	}
+}
+
+// checkVariables warns about the ${VAR} variables that aren't set,
+// and about the env values interpolated from the process environment,
+// which differs from machine to machine. The hooks aren't interpolated.
+func (v *validator) checkVariables(n *Node, path string) {
+	switch n.Kind {
+	case String:
+		v.checkStringVariables(n, path)
+	case Array:
+		for i, item := range n.Items {
+			v.checkVariables(item, fmt.Sprintf("%v[%d]", path, i))
+		}
+	case Object:
+		for _, k := range n.Keys {
+			if path != "" || k.Name != "hooks" {
+				v.checkVariables(k.Value, joinPath(path, k.Name))
+			}
+		}
+	}
+}
+
+func (v *validator) checkStringVariables(n *Node, path string) {
+	for _, m := range variablePattern.FindAllStringSubmatch(n.String, -1) {
+		if m[0] == "$$" {
+			continue
+		}
+
+		var _, onEnvironment = os.LookupEnv(m[1])
+		var _, onVars = Vars[m[1]]
+
+		switch {
+		case onEnvironment && strings.HasPrefix(path, "env."):
+			v.report(n.Position, path, true,
+				"${%v} is interpolated from the process environment (use $$ for a literal $)", m[1])
+		case !onEnvironment && !onVars && m[2] == "":
+			v.report(n.Position, path, true, "variable %v isn't set and is kept as ${%v}", m[1], m[1])
+		}
+	}
+}
+
+// additional gets the schema of additional properties, or if they aren't allowed
+func (s *Schema) additional() (additional *Schema, closed bool) {
+	switch raw := strings.TrimSpace(string(s.AdditionalProperties)); raw {
+	case "", "true":
+		return nil, false
+	case "false":
+		return nil, true
+	}
+
+	additional = &Schema{}
+
+	if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+		panic(err)
+	}
+
+	return additional, false
+}
+
+// suggest a known key for a typo, such as deploy_ignore for deployIgnore
+func (s *Schema) suggest(name string) string {
+	var names = []string{}
+
+	for known := range s.Properties {
+		names = append(names, known)
+	}
+
+	sort.Strings(names)
+
+	for _, known := range names {
+		if normalize(known) == normalize(name) || (len(name) > 3 &&
+			distance(strings.ToLower(known), strings.ToLower(name)) <= 2) {
+			return fmt.Sprintf(" (did you mean %q?)", known)
+		}
+	}
+
+	return ""
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// distance is the Levenshtein distance between two strings
+func distance(a, b string) int {
+	var prev = make([]int, len(b)+1)
+	var cur = make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			var cost = 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minimum(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minimum(values ...int) int {
+	var m = values[0]
+
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func article(kind string) string {
+	switch kind[0] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return "an " + kind
+	default:
+		return "a " + kind
+	}
+}
@@ -0,0 +1,444 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var n, err = Parse([]byte("{\n  \"a\": [1, \"ñ\", true],\n  \"b\": {\"c\": null}\n}"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	var a = n.Get("a")
+
+	if a.Kind != Array || len(a.Items) != 3 || a.Position != (Position{2, 8}) {
+		t.Errorf("Unexpected node %+v", a)
+	}
+
+	if s := a.Items[1]; s.String != "ñ" || s.Position != (Position{2, 12}) {
+		t.Errorf("Unexpected string node %+v", s)
+	}
+
+	if b := a.Items[2]; b.Kind != Bool || !b.Bool || b.Position != (Position{2, 17}) {
+		t.Errorf("Unexpected bool node %+v", b)
+	}
+
+	if c := n.Get("b").Get("c"); c.Kind != Null || c.Position != (Position{3, 14}) {
+		t.Errorf("Unexpected null node %+v", c)
+	}
+
+	if _, err = Parse([]byte("{\"a\": 1}}")); err == nil ||
+		err.Error() != `1:9: unexpected '}' after the end of the value` {
+		t.Errorf("Expected syntax error, got %v instead", err)
+	}
+
+	if _, err = Parse([]byte("{\"a\": 1,\n \"a\": 2}")); err == nil ||
+		err.Error() != `2:2: key "a" is already defined` {
+		t.Errorf("Expected duplicate key error, got %v instead", err)
+	}
+}
+
+func TestValidateProject(t *testing.T) {
+	var problems, err = ValidateProject("mocks/project")
+
+	if err != nil {
+		panic(err)
+	}
+
+	var got = []string{}
+
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+
+	var want = `mocks/project/broken/container.json:4:1: error: invalid JSON: expected a string for an object key
+mocks/project/duplicate: error: Multiple definitions found on mocks/project/duplicate: container.json, container.toml
+mocks/project/web/container.json:3:5: warning: unknown key "deployIgnore" (did you mean "deploy_ignore"?)
+mocks/project/web/container.json:4:5: warning: unknown key "instance" (did you mean "instances"?)
+mocks/project/web/container.json:5:13: error: port: expected an integer, got a string
+mocks/project/web/container.json:6:18: error: instances: expected an integer, got 1.5
+mocks/project/web/container.json:9:9: warning: unknown key "hooks.after"
+mocks/project/web/container.json:12:18: error: env.DEBUG: expected a string, got a boolean
+mocks/project/worker/container.yaml:3:1: warning: unknown key "instance" (did you mean "instances"?)
+mocks/project/worker/container.production.yaml:1:12: error: instances: expected an integer, got a string`
+
+	if strings.Join(got, "\n") != want {
+		t.Errorf("Wanted problems\n%v\ngot\n%v", want, strings.Join(got, "\n"))
+	}
+
+	if len(Errors(problems)) != 6 {
+		t.Errorf("Expected 6 errors, got %v instead", Errors(problems))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var warnings, err = Check("mocks/project/project.json", Project())
+
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("Expected no problems, got %v, %v instead", warnings, err)
+	}
+
+	if _, err = Check("mocks/project/web/container.json", Container()); err == nil {
+		t.Errorf("Expected validation error")
+	}
+
+	var problems = Validate("container.json", []byte(`{"name": "x", "depends_on": [""]}`), Container())
+
+	if len(problems) != 2 || problems[0].Message != `depends_on[0]: expected a non-empty string` ||
+		problems[1].Message != `missing required key "id"` {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	defer resetEnvironment()
+
+	var buf bytes.Buffer
+
+	if err := CheckDir("mocks/overlays", "container", Container(), &buf); err != nil {
+		t.Errorf("Expected no errors, got %v instead", err)
+	}
+
+	var want = "mocks/overlays/container.json:6:19: warning: env.DB_URL: " +
+		"variable DB_HOST isn't set and is kept as ${DB_HOST}\n"
+
+	if buf.String() != want {
+		t.Errorf("Wanted warnings %v, got %v instead", want, buf.String())
+	}
+
+	if err := CheckDir("mocks", "container", Container(), nil); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, got %v instead", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	var want = decodeMock(t, "mocks/formats/definition.json")
+
+	for _, file := range []string{
+		"mocks/formats/definition.yaml",
+		"mocks/formats/definition.toml",
+	} {
+		if got := decodeMock(t, file); !reflect.DeepEqual(got, want) {
+			t.Errorf("Wanted %v to be %v, got %v instead", file, want, got)
+		}
+	}
+}
+
+func TestParseFilePositions(t *testing.T) {
+	for file, want := range map[string]Position{
+		"mocks/formats/definition.yaml": {9, 3},
+		"mocks/formats/definition.toml": {15, 1},
+	} {
+		var content, err = ioutil.ReadFile(file)
+
+		if err != nil {
+			panic(err)
+		}
+
+		var n *Node
+
+		if n, err = ParseFile(file, content); err != nil {
+			panic(err)
+		}
+
+		var k = n.Get("env").Keys[0]
+
+		if k.Name != "GREETING" || k.Position != want {
+			t.Errorf("Wanted %v key GREETING at %v, got %v at %v instead",
+				file, want, k.Name, k.Position)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	var cases = map[string]string{
+		"a = 1\na = 2":      `2:1: key "a" is already defined`,
+		"a = [1, 2":         `1:10: expected ',' or ']' after array value`,
+		"a = \"b":           `1:7: unterminated string`,
+		"a = 1 b = 2":       `1:7: unexpected 'b' at the end of the line`,
+		"a = inf":           `1:5: infinite and NaN numbers aren't supported`,
+		"[a]\nb = 1\n[a.b]": `3:4: key "b" is already defined`,
+	}
+
+	for content, want := range cases {
+		if _, err := ParseTOML([]byte(content)); err == nil || err.Error() != want {
+			t.Errorf("Wanted error %v for %q, got %v instead", want, content, err)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	var cases = map[string]string{
+		"x: &a [*a]":            `1:8: alias *a is recursive`,
+		"x: &a {y: [1, *a]}":    `1:15: alias *a is recursive`,
+		"a: 1\nb: {c: 2, c: 3}": `2:11: key "c" is already defined`,
+		"a: 1\n---\na: 2":       `2:1: multiple documents aren't supported`,
+	}
+
+	for content, want := range cases {
+		if _, err := ParseYAML([]byte(content)); err == nil || err.Error() != want {
+			t.Errorf("Wanted error %v for %q, got %v instead", want, content, err)
+		}
+	}
+
+	if _, err := ParseYAML([]byte("x: &a [1]\ny: [*a, *a]")); err != nil {
+		t.Errorf("Expected aliases used more than once to be expanded, got %v instead", err)
+	}
+
+	var n, err = ParseYAML([]byte("base: &base {a: 1, b: 2}\nx:\n  <<: *base\n  a: 3"))
+
+	if err != nil || n.Get("x").Get("a").Number != 3 || len(n.Get("x").Keys) != 2 {
+		t.Errorf("Expected merged keys to be overridden, got %v instead", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var want = decodeMock(t, "mocks/formats/definition.json")
+
+	for _, ext := range []string{".yaml", ".toml", ".json"} {
+		var dest, content, err = Convert("mocks/formats/definition.json", ext)
+
+		if err != nil {
+			t.Errorf("Expected no error converting to %v, got %v instead", ext, err)
+		}
+
+		if dest != "mocks/formats/definition"+ext {
+			t.Errorf("Unexpected destination %v", dest)
+		}
+
+		var n *Node
+
+		if n, err = ParseFile(dest, content); err != nil {
+			t.Errorf("Can't parse converted definition %v: %v", dest, err)
+			continue
+		}
+
+		if got := decodeNode(t, n); !reflect.DeepEqual(got, want) {
+			t.Errorf("Wanted %v to be %v, got %v instead", dest, want, got)
+		}
+	}
+}
+
+func TestEncodeTOMLNull(t *testing.T) {
+	var n, err = Parse([]byte(`{"hooks": {"build": null}}`))
+
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err = EncodeTOML(n); err == nil ||
+		err.Error() != "hooks.build: null values can't be represented in TOML" {
+		t.Errorf("Expected null error, got %v instead", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	if file, err := Find("mocks/project/worker", "container"); err != nil ||
+		file != filepath.Join("mocks/project/worker", "container.yaml") {
+		t.Errorf("Unexpected definition %v, error %v", file, err)
+	}
+
+	if _, err := Find("mocks/project/notes", "container"); !os.IsNotExist(err) {
+		t.Errorf("Expected not exists error, got %v instead", err)
+	}
+
+	var _, err = Find("mocks/project/duplicate", "container")
+
+	if me, ok := err.(MultipleDefinitionsError); !ok ||
+		!reflect.DeepEqual(me.Files, []string{"container.json", "container.toml"}) {
+		t.Errorf("Expected multiple definitions error, got %v instead", err)
+	}
+}
+
+func TestFindDefinition(t *testing.T) {
+	var cases = map[string]string{
+		"mocks/project":                    "mocks/project/project.json",
+		"mocks/project/worker":             "mocks/project/worker/container.yaml",
+		"mocks/project/web/container.json": "mocks/project/web/container.json",
+	}
+
+	for path, want := range cases {
+		if file, err := FindDefinition(path); err != nil || file != filepath.FromSlash(want) {
+			t.Errorf("Wanted definition %v for %v, got %v (error: %v) instead", want, path, file, err)
+		}
+	}
+
+	if _, err := FindDefinition("mocks/project/notes"); err == nil ||
+		err.Error() != "no project or container definition found on mocks/project/notes" {
+		t.Errorf("Expected no definition error, got %v instead", err)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	defer resetEnvironment()
+
+	Vars = map[string]string{"DB_HOST": "db", "SENTRY_DSN": "dsn"}
+
+	var cases = map[string]string{
+		"": `{"id":"email","instances":1,"port":8080,` +
+			`"env":{"DB_URL":"postgres://db:5432/mail","LEVEL":"info","PRICE":"$5","REGION":"us"},` +
+			`"hooks":{"build":"echo ${HOME}"}}`,
+		"production": `{"id":"email","instances":3,` +
+			`"env":{"DB_URL":"postgres://db:5432/mail","LEVEL":"warn","PRICE":"$5","SENTRY":"dsn"},` +
+			`"hooks":{"build":"echo ${HOME}"}}`,
+		"staging": `{"id":"email","instances":1,"port":8080,` +
+			`"env":{"DB_URL":"postgres://db:5432/mail","LEVEL":"info","PRICE":"$5","REGION":"us"},` +
+			`"hooks":{"build":"echo ${HOME}"}}`,
+	}
+
+	for environment, want := range cases {
+		Environment = environment
+
+		var content, err = ReadFile("mocks/overlays/container.json")
+
+		if err != nil || string(content) != want {
+			t.Errorf("Wanted %v for environment %q, got %v (error: %v) instead",
+				want, environment, string(content), err)
+		}
+	}
+}
+
+func TestReadFileVariables(t *testing.T) {
+	defer resetEnvironment()
+
+	if err := os.Setenv("DB_HOST", "primary"); err != nil {
+		panic(err)
+	}
+
+	defer os.Unsetenv("DB_HOST")
+
+	Vars = map[string]string{"DB_HOST": "db", "LEVEL": "debug"}
+
+	var content, err = ReadFile("mocks/overlays/container.json")
+
+	if err != nil || !strings.Contains(string(content), `"DB_URL":"postgres://primary:5432/mail","LEVEL":"debug"`) {
+		t.Errorf("Expected the environment to take precedence over vars, got %v (error: %v)",
+			string(content), err)
+	}
+
+	Environment = "production"
+	Vars = map[string]string{}
+
+	content, err = ReadFile("mocks/overlays/container.json")
+
+	if err != nil || !strings.Contains(string(content), `"SENTRY":"${SENTRY_DSN}"`) {
+		t.Errorf("Expected variables that aren't set to be kept, got %v (error: %v)",
+			string(content), err)
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	defer resetEnvironment()
+
+	if err := os.Setenv("DB_HOST", "primary"); err != nil {
+		panic(err)
+	}
+
+	defer os.Unsetenv("DB_HOST")
+
+	Environment = "production"
+	Vars = map[string]string{}
+
+	var warnings, err = Check("mocks/overlays/container.json", Container())
+
+	if err != nil {
+		panic(err)
+	}
+
+	var got = []string{}
+
+	for _, w := range warnings {
+		got = append(got, w.String())
+	}
+
+	var want = []string{
+		"mocks/overlays/container.json:6:19: warning: env.DB_URL: " +
+			"${DB_HOST} is interpolated from the process environment (use $$ for a literal $)",
+		"mocks/overlays/container.production.yaml:7:11: warning: env.SENTRY: " +
+			"variable SENTRY_DSN isn't set and is kept as ${SENTRY_DSN}",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted warnings %v, got %v instead", want, got)
+	}
+}
+
+func TestHasVariables(t *testing.T) {
+	var cases = map[string]bool{
+		"postgres://${DB_HOST}:5432": true,
+		"${LEVEL:-info}":             true,
+		"$$5":                        false,
+		"$5 and $HOME":               false,
+		"plain":                      false,
+	}
+
+	for s, want := range cases {
+		if got := HasVariables(s); got != want {
+			t.Errorf("Wanted HasVariables(%v) to be %v, got %v instead", s, want, got)
+		}
+	}
+}
+
+func TestCheckOverlay(t *testing.T) {
+	defer resetEnvironment()
+
+	Environment = "production"
+	Vars = map[string]string{"DB_HOST": "db", "SENTRY_DSN": "dsn"}
+
+	if warnings, err := Check("mocks/overlays/container.json", Container()); err != nil || len(warnings) != 0 {
+		t.Errorf("Expected no problems, got %v, %v instead", warnings, err)
+	}
+
+	var _, err = Check("mocks/project/worker/container.yaml", Container())
+
+	if ve, ok := err.(ValidationError); !ok || len(ve.Problems) != 2 ||
+		ve.Problems[1].File != "mocks/project/worker/container.production.yaml" {
+		t.Errorf("Expected overlay validation error, got %v instead", err)
+	}
+}
+
+func resetEnvironment() {
+	Environment = ""
+	Vars = map[string]string{}
+}
+
+func decodeMock(t *testing.T, file string) interface{} {
+	var content, err = DecodeFile(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v interface{}
+
+	if err = json.Unmarshal(content, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func decodeNode(t *testing.T, n *Node) interface{} {
+	var content, err = n.MarshalJSON()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v interface{}
+
+	if err = json.Unmarshal(content, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
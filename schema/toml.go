@@ -0,0 +1,670 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlValueChars are the characters of numbers, booleans and dates, besides letters and digits
+const tomlValueChars = "_-+.:"
+
+type tomlParser struct {
+	parser
+	root *Node
+}
+
+// ParseTOML parses TOML keeping the position of its values
+// Dates and times are kept as strings.
+func ParseTOML(data []byte) (*Node, error) {
+	var p = &tomlParser{parser: parser{data: data, line: 1, column: 1}}
+	var table = &Node{Kind: Object, Position: Position{1, 1}}
+
+	p.root = table
+
+	for {
+		p.blank()
+
+		if p.offset >= len(p.data) {
+			return p.root, nil
+		}
+
+		var err error
+
+		switch p.peek() {
+		case '[':
+			table, err = p.header()
+		default:
+			err = p.keyValue(table)
+		}
+
+		if err == nil {
+			err = p.lineEnd()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// space skips spaces and tabs
+func (p *tomlParser) space() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.next()
+	}
+}
+
+// blank skips whitespace, new lines and comments
+func (p *tomlParser) blank() {
+	for p.offset < len(p.data) {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		case '#':
+			p.comment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) comment() {
+	for p.offset < len(p.data) && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+func (p *tomlParser) lineEnd() error {
+	p.space()
+
+	if p.peek() == '#' {
+		p.comment()
+	}
+
+	if p.peek() == '\r' {
+		p.next()
+	}
+
+	switch {
+	case p.offset >= len(p.data):
+		return nil
+	case p.peek() == '\n':
+		p.next()
+		return nil
+	}
+
+	return p.errorf("unexpected %q at the end of the line", p.peek())
+}
+
+func (p *tomlParser) header() (*Node, error) {
+	var pos = p.position()
+	var array = p.hasPrefix("[[")
+
+	p.next()
+
+	if array {
+		p.next()
+	}
+
+	p.space()
+
+	var keys, err = p.keys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.space()
+
+	switch {
+	case array && !p.hasPrefix("]]"):
+		return nil, p.errorf("expected ']]' after table name")
+	case !array && p.peek() != ']':
+		return nil, p.errorf("expected ']' after table name")
+	}
+
+	p.next()
+
+	if array {
+		p.next()
+	}
+
+	var parent *Node
+
+	if parent, err = p.descend(p.root, keys[:len(keys)-1]); err != nil {
+		return nil, err
+	}
+
+	var last = keys[len(keys)-1]
+	var existing = parent.Get(last.Name)
+	var table = &Node{Kind: Object, Position: pos}
+
+	switch {
+	case array && existing == nil:
+		parent.Keys = append(parent.Keys, &Key{last.Name, last.Position,
+			&Node{Kind: Array, Position: pos, Items: []*Node{table}}})
+	case array && existing.Kind == Array:
+		existing.Items = append(existing.Items, table)
+	case !array && existing == nil:
+		parent.Keys = append(parent.Keys, &Key{last.Name, last.Position, table})
+	case !array && existing.Kind == Object:
+		table = existing
+	default:
+		return nil, SyntaxError{last.Position, fmt.Sprintf("key %q is already defined", last.Name)}
+	}
+
+	return table, nil
+}
+
+// descend into the tables of a dotted key, creating them when needed
+func (p *tomlParser) descend(table *Node, keys []*Key) (*Node, error) {
+	for _, k := range keys {
+		var next = table.Get(k.Name)
+
+		switch {
+		case next == nil:
+			next = &Node{Kind: Object, Position: k.Position}
+			table.Keys = append(table.Keys, &Key{k.Name, k.Position, next})
+		case next.Kind == Array && len(next.Items) != 0 && next.Items[len(next.Items)-1].Kind == Object:
+			next = next.Items[len(next.Items)-1]
+		case next.Kind != Object:
+			return nil, SyntaxError{k.Position, fmt.Sprintf("key %q isn't a table", k.Name)}
+		}
+
+		table = next
+	}
+
+	return table, nil
+}
+
+func (p *tomlParser) keyValue(table *Node) error {
+	var keys, err = p.keys()
+
+	if err != nil {
+		return err
+	}
+
+	p.space()
+
+	if p.peek() != '=' {
+		return p.errorf("expected '=' after key")
+	}
+
+	p.next()
+	p.space()
+
+	var value *Node
+
+	if value, err = p.value(); err != nil {
+		return err
+	}
+
+	if table, err = p.descend(table, keys[:len(keys)-1]); err != nil {
+		return err
+	}
+
+	var last = keys[len(keys)-1]
+
+	if table.Get(last.Name) != nil {
+		return SyntaxError{last.Position, fmt.Sprintf("key %q is already defined", last.Name)}
+	}
+
+	last.Value = value
+	table.Keys = append(table.Keys, last)
+	return nil
+}
+
+// keys parses a dotted key, such as hooks.build or "a b".c
+func (p *tomlParser) keys() ([]*Key, error) {
+	var keys []*Key
+
+	for {
+		var k = &Key{Position: p.position()}
+		var err error
+
+		switch p.peek() {
+		case '"':
+			k.Name, err = p.basicString()
+		case '\'':
+			k.Name, err = p.literalString()
+		default:
+			k.Name = p.bare("_-")
+
+			if !tomlBareKey.MatchString(k.Name) {
+				err = p.errorf("invalid key")
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+		p.space()
+
+		if p.peek() != '.' {
+			return keys, nil
+		}
+
+		p.next()
+		p.space()
+	}
+}
+
+// bare reads letters, digits and the given characters, as on a bare key or value
+func (p *tomlParser) bare(chars string) string {
+	var start = p.offset
+
+	for p.offset < len(p.data) {
+		var c = p.peek()
+
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			!strings.ContainsRune(chars, rune(c)) {
+			break
+		}
+
+		p.next()
+	}
+
+	return string(p.data[start:p.offset])
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(p.data[p.offset:], []byte(prefix))
+}
+
+func (p *tomlParser) value() (*Node, error) {
+	var n = &Node{Position: p.position()}
+	var err error
+
+	switch c := p.peek(); {
+	case p.offset >= len(p.data):
+		return nil, p.errorf("unexpected end of TOML")
+	case c == '"' && p.hasPrefix(`"""`):
+		n.Kind = String
+		n.String, err = p.multilineString(`"""`)
+	case c == '"':
+		n.Kind = String
+		n.String, err = p.basicString()
+	case c == '\'' && p.hasPrefix(`'''`):
+		n.Kind = String
+		n.String, err = p.multilineString(`'''`)
+	case c == '\'':
+		n.Kind = String
+		n.String, err = p.literalString()
+	case c == '[':
+		n.Kind = Array
+		err = p.array(n)
+	case c == '{':
+		n.Kind = Object
+		err = p.inlineTable(n)
+	default:
+		err = p.scalar(n)
+	}
+
+	return n, err
+}
+
+func (p *tomlParser) scalar(n *Node) error {
+	var raw = p.bare(tomlValueChars)
+
+	// local times and dates with a space between the date and the time
+	if p.peek() == ' ' && strings.Count(raw, "-") == 2 && len(p.data) > p.offset+1 &&
+		p.data[p.offset+1] >= '0' && p.data[p.offset+1] <= '9' {
+		p.next()
+		raw += " " + p.bare(tomlValueChars)
+	}
+
+	switch {
+	case raw == "true" || raw == "false":
+		n.Kind, n.Bool = Bool, raw == "true"
+		return nil
+	case raw == "":
+		return p.errorf("invalid character %q looking for a value", p.peek())
+	case strings.Contains(raw, ":") || (len(raw) >= 10 && raw[4] == '-' && raw[7] == '-'):
+		n.Kind, n.String = String, raw
+		return nil
+	}
+
+	n.Kind = Number
+	return p.number(n, raw)
+}
+
+func (p *tomlParser) number(n *Node, raw string) error {
+	var digits = strings.Replace(raw, "_", "", -1)
+	var i int64
+	var err error
+
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		i, err = strconv.ParseInt(digits[2:], 16, 64)
+	case strings.HasPrefix(digits, "0o"):
+		i, err = strconv.ParseInt(digits[2:], 8, 64)
+	case strings.HasPrefix(digits, "0b"):
+		i, err = strconv.ParseInt(digits[2:], 2, 64)
+	case strings.ContainsAny(digits, ".eE") || strings.HasSuffix(digits, "inf") || strings.HasSuffix(digits, "nan"):
+		if n.Number, err = strconv.ParseFloat(digits, 64); err == nil {
+			return checkFinite(n)
+		}
+	default:
+		i, err = strconv.ParseInt(digits, 10, 64)
+	}
+
+	if err != nil {
+		return SyntaxError{n.Position, "invalid value " + raw}
+	}
+
+	n.Number, n.Raw = float64(i), strconv.FormatInt(i, 10)
+	return nil
+}
+
+func (p *tomlParser) array(n *Node) error {
+	p.next()
+
+	for {
+		p.blank()
+
+		if p.peek() == ']' {
+			p.next()
+			return nil
+		}
+
+		var item, err = p.value()
+
+		if err != nil {
+			return err
+		}
+
+		n.Items = append(n.Items, item)
+		p.blank()
+
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+			p.next()
+			return nil
+		default:
+			return p.errorf("expected ',' or ']' after array value")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable(n *Node) error {
+	p.next()
+	p.space()
+
+	if p.peek() == '}' {
+		p.next()
+		return nil
+	}
+
+	for {
+		p.space()
+
+		if err := p.keyValue(n); err != nil {
+			return err
+		}
+
+		p.space()
+
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			return nil
+		default:
+			return p.errorf("expected ',' or '}' after inline table value")
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.next()
+
+	var start = p.offset
+
+	for p.peek() != '\'' {
+		if p.offset >= len(p.data) || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+
+		p.next()
+	}
+
+	var s = string(p.data[start:p.offset])
+	p.next()
+	return s, nil
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.next()
+
+	var buf bytes.Buffer
+
+	for {
+		switch c := p.peek(); {
+		case p.offset >= len(p.data) || c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '"':
+			p.next()
+			return buf.String(), nil
+		case c == '\\':
+			if err := p.escape(&buf); err != nil {
+				return "", err
+			}
+		case c < 0x20 && c != '\t':
+			return "", p.errorf("invalid control character in string")
+		default:
+			buf.WriteByte(p.next())
+		}
+	}
+}
+
+// multilineString reads a """ or ”' string
+// A new line right after the opening delimiter is trimmed.
+func (p *tomlParser) multilineString(delim string) (string, error) {
+	var buf bytes.Buffer
+
+	for range delim {
+		p.next()
+	}
+
+	if p.hasPrefix("\r\n") {
+		p.next()
+	}
+
+	if p.peek() == '\n' {
+		p.next()
+	}
+
+	for {
+		switch c := p.peek(); {
+		case p.offset >= len(p.data):
+			return "", p.errorf("unterminated string")
+		case p.hasPrefix(delim):
+			for range delim {
+				p.next()
+			}
+
+			// up to two quotes are allowed right before the closing delimiter
+			for i := 0; i < 2 && p.peek() == delim[0]; i++ {
+				buf.WriteByte(p.next())
+			}
+
+			return buf.String(), nil
+		case c == '\\' && delim == `"""` && p.lineEndingBackslash():
+			p.blank()
+		case c == '\\' && delim == `"""`:
+			if err := p.escape(&buf); err != nil {
+				return "", err
+			}
+		default:
+			buf.WriteByte(p.next())
+		}
+	}
+}
+
+// lineEndingBackslash tells if a \ is the last character of a line
+func (p *tomlParser) lineEndingBackslash() bool {
+	for _, c := range p.data[p.offset+1:] {
+		switch c {
+		case ' ', '\t', '\r':
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+var tomlEscapes = map[byte]string{
+	'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", '"': `"`, '\\': `\`,
+}
+
+func (p *tomlParser) escape(buf *bytes.Buffer) error {
+	var pos = p.position()
+
+	p.next()
+
+	if p.offset >= len(p.data) {
+		return p.errorf("unterminated string")
+	}
+
+	var c = p.next()
+
+	if s, ok := tomlEscapes[c]; ok {
+		buf.WriteString(s)
+		return nil
+	}
+
+	var size = map[byte]int{'u': 4, 'U': 8}[c]
+
+	if size == 0 || p.offset+size > len(p.data) {
+		return SyntaxError{pos, "invalid escape sequence"}
+	}
+
+	var code, err = strconv.ParseUint(string(p.data[p.offset:p.offset+size]), 16, 32)
+
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return SyntaxError{pos, "invalid escape sequence"}
+	}
+
+	for i := 0; i < size; i++ {
+		p.next()
+	}
+
+	buf.WriteRune(rune(code))
+	return nil
+}
+
+// EncodeTOML encodes an object node as TOML
+// Objects are written as tables, except inside arrays.
+func EncodeTOML(n *Node) ([]byte, error) {
+	if n.Kind != Object {
+		return nil, fmt.Errorf("only objects can be encoded as TOML")
+	}
+
+	var buf bytes.Buffer
+	var err = encodeTOMLTable(&buf, n, nil)
+	return buf.Bytes(), err
+}
+
+func encodeTOMLTable(buf *bytes.Buffer, n *Node, path []string) error {
+	for _, k := range n.Keys {
+		if k.Value.Kind == Object {
+			continue
+		}
+
+		var value, err = encodeTOMLValue(k.Value, append(path, k.Name))
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(buf, "%v = %v\n", tomlKey(k.Name), value)
+	}
+
+	for _, k := range n.Keys {
+		if k.Value.Kind != Object {
+			continue
+		}
+
+		var tablePath = append(append([]string{}, path...), k.Name)
+		var names = []string{}
+
+		for _, name := range tablePath {
+			names = append(names, tomlKey(name))
+		}
+
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+
+		fmt.Fprintf(buf, "[%v]\n", strings.Join(names, "."))
+
+		if err := encodeTOMLTable(buf, k.Value, tablePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeTOMLValue(n *Node, path []string) (string, error) {
+	switch n.Kind {
+	case String:
+		return quote(n.String), nil
+	case Number:
+		return n.Raw, nil
+	case Bool:
+		return strconv.FormatBool(n.Bool), nil
+	case Array:
+		var items = []string{}
+
+		for i, item := range n.Items {
+			var s, err = encodeTOMLValue(item, append(path, strconv.Itoa(i)))
+
+			if err != nil {
+				return "", err
+			}
+
+			items = append(items, s)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case Object:
+		var keys = []string{}
+
+		for _, k := range n.Keys {
+			var s, err = encodeTOMLValue(k.Value, append(path, k.Name))
+
+			if err != nil {
+				return "", err
+			}
+
+			keys = append(keys, tomlKey(k.Name)+" = "+s)
+		}
+
+		return "{" + strings.Join(keys, ", ") + "}", nil
+	}
+
+	return "", fmt.Errorf("%v: null values can't be represented in TOML", strings.Join(path, "."))
+}
+
+func tomlKey(name string) string {
+	if tomlBareKey.MatchString(name) {
+		return name
+	}
+
+	return quote(name)
+}
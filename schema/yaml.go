@@ -0,0 +1,326 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// ParseYAML parses YAML keeping the position of its values
+func ParseYAML(data []byte) (*Node, error) {
+	var doc, err = decodeYAML(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return nil, SyntaxError{Position{1, 1}, "empty document"}
+	}
+
+	var d = &yamlDecoder{expanding: map[*yaml.Node]bool{}}
+	return d.fromYAML(doc.Content[0])
+}
+
+// decodeYAML decodes a YAML document
+// Definitions have a single document, so the others would be lost.
+func decodeYAML(data []byte) (*yaml.Node, error) {
+	var decoder = yaml.NewDecoder(bytes.NewReader(data))
+	var doc, next yaml.Node
+
+	switch err := decoder.Decode(&doc); {
+	case err == io.EOF:
+		return &doc, nil
+	case err != nil:
+		return nil, yamlSyntaxError(err)
+	}
+
+	switch err := decoder.Decode(&next); {
+	case err == io.EOF:
+		return &doc, nil
+	case err != nil:
+		return nil, yamlSyntaxError(err)
+	}
+
+	return nil, SyntaxError{Position{next.Line, next.Column}, "multiple documents aren't supported"}
+}
+
+func yamlSyntaxError(err error) error {
+	var m = yamlErrorLine.FindStringSubmatch(err.Error())
+
+	if m == nil {
+		return SyntaxError{Position{1, 1}, err.Error()}
+	}
+
+	var line, _ = strconv.Atoi(m[1])
+	return SyntaxError{Position{line, 1}, m[2]}
+}
+
+// yamlDecoder converts YAML nodes, tracking the anchors whose aliases
+// are being expanded, as an alias inside its own anchor never ends
+type yamlDecoder struct {
+	expanding map[*yaml.Node]bool
+}
+
+func (d *yamlDecoder) fromYAML(y *yaml.Node) (*Node, error) {
+	var n = &Node{Position: Position{y.Line, y.Column}}
+
+	switch y.Kind {
+	case yaml.AliasNode:
+		return d.fromYAMLAlias(y)
+	case yaml.MappingNode:
+		n.Kind = Object
+		return n, d.fromYAMLMapping(n, y)
+	case yaml.SequenceNode:
+		n.Kind = Array
+
+		for _, c := range y.Content {
+			var item, err = d.fromYAML(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			n.Items = append(n.Items, item)
+		}
+
+		return n, nil
+	}
+
+	return n, fromYAMLScalar(n, y)
+}
+
+func (d *yamlDecoder) fromYAMLAlias(y *yaml.Node) (*Node, error) {
+	if d.expanding[y.Alias] {
+		return nil, SyntaxError{Position{y.Line, y.Column},
+			fmt.Sprintf("alias *%v is recursive", y.Value)}
+	}
+
+	d.expanding[y.Alias] = true
+	defer delete(d.expanding, y.Alias)
+
+	return d.fromYAML(y.Alias)
+}
+
+func (d *yamlDecoder) fromYAMLMapping(n *Node, y *yaml.Node) error {
+	var explicit = map[string]bool{}
+
+	for i := 0; i+1 < len(y.Content); i += 2 {
+		var key, value = y.Content[i], y.Content[i+1]
+
+		if key.Kind != yaml.ScalarNode {
+			return SyntaxError{Position{key.Line, key.Column}, "keys must be strings"}
+		}
+
+		var v, err = d.fromYAML(value)
+
+		if err != nil {
+			return err
+		}
+
+		if key.ShortTag() == "!!merge" {
+			mergeKeys(n, v)
+			continue
+		}
+
+		if explicit[key.Value] {
+			return SyntaxError{Position{key.Line, key.Column},
+				fmt.Sprintf("key %q is already defined", key.Value)}
+		}
+
+		// keys set explicitly take precedence over the merged ones
+		explicit[key.Value] = true
+		removeKey(n, key.Value)
+
+		n.Keys = append(n.Keys, &Key{
+			Name:     key.Value,
+			Position: Position{key.Line, key.Column},
+			Value:    v,
+		})
+	}
+
+	return nil
+}
+
+// mergeKeys merges the keys of a << value that aren't set yet
+func mergeKeys(n *Node, merge *Node) {
+	var sources = merge.Items
+
+	if merge.Kind == Object {
+		sources = []*Node{merge}
+	}
+
+	for _, s := range sources {
+		for _, k := range s.Keys {
+			if n.Get(k.Name) == nil {
+				n.Keys = append(n.Keys, k)
+			}
+		}
+	}
+}
+
+func removeKey(n *Node, name string) {
+	for i, k := range n.Keys {
+		if k.Name == name {
+			n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func fromYAMLScalar(n *Node, y *yaml.Node) error {
+	var err error
+
+	switch y.ShortTag() {
+	case "!!null":
+		n.Kind = Null
+	case "!!bool":
+		n.Kind = Bool
+		err = y.Decode(&n.Bool)
+	case "!!int":
+		var i int64
+		n.Kind = Number
+
+		if err = y.Decode(&i); err == nil {
+			n.Number, n.Raw = float64(i), strconv.FormatInt(i, 10)
+		}
+	case "!!float":
+		n.Kind = Number
+
+		if err = y.Decode(&n.Number); err == nil {
+			err = checkFinite(n)
+		}
+	default:
+		n.Kind, n.String = String, y.Value
+	}
+
+	if err != nil {
+		return SyntaxError{n.Position, fmt.Sprintf("invalid value %q", y.Value)}
+	}
+
+	return nil
+}
+
+// checkFinite sets the JSON representation of a float,
+// which can't be infinite or NaN
+func checkFinite(n *Node) error {
+	if math.IsInf(n.Number, 0) || math.IsNaN(n.Number) {
+		return SyntaxError{n.Position, "infinite and NaN numbers aren't supported"}
+	}
+
+	n.Raw = strconv.FormatFloat(n.Number, 'g', -1, 64)
+	return nil
+}
+
+// SetYAMLKey sets a key of a YAML object, or removes it if the value is nil
+// The comments and the order of the other keys are kept.
+func SetYAMLKey(content []byte, key string, value interface{}) ([]byte, error) {
+	var doc, err = decodeYAML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the definition isn't a YAML object")
+	}
+
+	var m = doc.Content[0]
+	var v = &yaml.Node{}
+
+	if err = v.Encode(value); err != nil {
+		return nil, err
+	}
+
+	var found = false
+
+	for i := 0; i+1 < len(m.Content) && !found; i += 2 {
+		if m.Content[i].Value != key {
+			continue
+		}
+
+		found = true
+
+		if value == nil {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+		} else {
+			m.Content[i+1] = v
+		}
+	}
+
+	if !found && value != nil {
+		m.Content = append(m.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+
+	return encodeYAML(doc)
+}
+
+// EncodeYAML encodes a node as YAML
+func EncodeYAML(n *Node) ([]byte, error) {
+	return encodeYAML(toYAML(n))
+}
+
+func encodeYAML(y *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	var encoder = yaml.NewEncoder(&buf)
+
+	encoder.SetIndent(2)
+
+	var err = encoder.Encode(y)
+
+	if err == nil {
+		err = encoder.Close()
+	}
+
+	return buf.Bytes(), err
+}
+
+func toYAML(n *Node) *yaml.Node {
+	switch n.Kind {
+	case Object:
+		var y = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+		for _, k := range n.Keys {
+			y.Content = append(y.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.Name}, toYAML(k.Value))
+		}
+
+		return y
+	case Array:
+		var y = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+		for _, item := range n.Items {
+			y.Content = append(y.Content, toYAML(item))
+		}
+
+		return y
+	case String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: n.String}
+	case Number:
+		var tag = "!!float"
+
+		if isInteger(n) {
+			tag = "!!int"
+		}
+
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: n.Raw}
+	case Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(n.Bool)}
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
+
+// isInteger tells if a number is written as an integer, such as 10 but not 1.0 or 1e1
+func isInteger(n *Node) bool {
+	var _, err = strconv.ParseInt(n.Raw, 10, 64)
+	return err == nil
+}
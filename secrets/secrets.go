@@ -0,0 +1,341 @@
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wedeploy/cli/user"
+	"github.com/wedeploy/cli/verbose"
+)
+
+// Keyring holds the keys of a project, the current key first
+// Older keys are only used to decrypt values.
+type Keyring struct {
+	Keys [][]byte
+}
+
+// DecryptError is used when an encrypted value can't be decrypted
+type DecryptError struct {
+	Name string
+	Err  error
+}
+
+// Prefix of encrypted values, which are stored as enc:<key id>:<base64 data>
+const Prefix = "enc:"
+
+// KeyEnv is the environment variable with base64 keys (comma separated)
+// used instead of the keyring file, such as on continuous integration.
+const KeyEnv = "WEDEPLOY_SECRETS_KEY"
+
+const keySize = 32
+
+var (
+	// ErrNoKey is used when a project has no keyring
+	ErrNoKey = errors.New("No secrets key for the project. Use \"we secrets init\" or \"we secrets import\"")
+
+	// ErrKeyExists is used when creating a keyring for a project that has one
+	ErrKeyExists = errors.New("The project already has a secrets key")
+
+	// ErrUnknownKey is used when a value was encrypted with a key not on the keyring
+	ErrUnknownKey = errors.New("Value encrypted with a key not on the keyring")
+
+	// ErrInvalidKey is used when a key can't be decoded
+	ErrInvalidKey = errors.New("Invalid secrets key")
+
+	// KeysDir is where the keyrings are saved, one file per project
+	KeysDir = filepath.Join(user.GetHomeDir(), ".we_secrets")
+)
+
+func (d DecryptError) Error() string {
+	return fmt.Sprintf("Can't decrypt %v: %v", d.Name, d.Err)
+}
+
+// IsEncrypted tells if a value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// HasEncrypted tells if any environment variable is encrypted
+func HasEncrypted(env map[string]string) bool {
+	for _, value := range env {
+		if IsEncrypted(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeyPath is the path of the keyring of a project
+func KeyPath(projectID string) string {
+	return filepath.Join(KeysDir, projectID+".key")
+}
+
+// New creates a keyring with a random key
+func New() (*Keyring, error) {
+	var key = make([]byte, keySize)
+
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return &Keyring{[][]byte{key}}, nil
+}
+
+// ParseKey decodes a base64 key
+func ParseKey(s string) ([]byte, error) {
+	var key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+
+	if err != nil || len(key) != keySize {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// FormatKey encodes a key as base64
+func FormatKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Load the keyring of a project, from KeyEnv if set or from its file
+func Load(projectID string) (*Keyring, error) {
+	if env := os.Getenv(KeyEnv); env != "" {
+		return parseKeyring(strings.NewReader(strings.Replace(env, ",", "\n", -1)))
+	}
+
+	var f, err = os.Open(KeyPath(projectID))
+
+	if os.IsNotExist(err) {
+		return nil, ErrNoKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return parseKeyring(f)
+}
+
+func parseKeyring(r io.Reader) (*Keyring, error) {
+	var k = &Keyring{}
+	var scanner = bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var line = strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var key, err = ParseKey(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		k.Keys = append(k.Keys, key)
+	}
+
+	if len(k.Keys) == 0 {
+		return nil, ErrNoKey
+	}
+
+	return k, scanner.Err()
+}
+
+// Save the keyring of a project, readable only by the user
+func (k *Keyring) Save(projectID string) error {
+	if err := os.MkdirAll(KeysDir, 0700); err != nil {
+		return err
+	}
+
+	var lines = []string{}
+
+	for _, key := range k.Keys {
+		lines = append(lines, FormatKey(key))
+	}
+
+	return ioutil.WriteFile(KeyPath(projectID),
+		[]byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// Rotate adds a new current key to the keyring
+func (k *Keyring) Rotate() error {
+	var n, err = New()
+
+	if err == nil {
+		k.Keys = append(n.Keys, k.Keys...)
+	}
+
+	return err
+}
+
+// Encrypt a value with the current key
+// The name of the variable is authenticated, so values can't be swapped.
+func (k *Keyring) Encrypt(name, value string) (string, error) {
+	var key = k.Keys[0]
+	var gcm, err = newGCM(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	var nonce = make([]byte, gcm.NonceSize())
+
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	var sealed = gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	return Prefix + keyID(key) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a value encrypted with any key of the keyring
+func (k *Keyring) Decrypt(name, value string) (string, error) {
+	var parts = strings.SplitN(strings.TrimPrefix(value, Prefix), ":", 2)
+
+	if !IsEncrypted(value) || len(parts) != 2 {
+		return "", DecryptError{name, errors.New("not an encrypted value")}
+	}
+
+	var key = k.find(parts[0])
+
+	if key == nil {
+		return "", DecryptError{name, ErrUnknownKey}
+	}
+
+	var sealed, err = base64.StdEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return "", DecryptError{name, err}
+	}
+
+	var gcm cipher.AEAD
+
+	if gcm, err = newGCM(key); err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", DecryptError{name, errors.New("value too short")}
+	}
+
+	var plain []byte
+	var nonce = sealed[:gcm.NonceSize()]
+
+	if plain, err = gcm.Open(nil, nonce, sealed[gcm.NonceSize():], []byte(name)); err != nil {
+		return "", DecryptError{name, err}
+	}
+
+	redact(string(plain))
+	return string(plain), nil
+}
+
+// Current tells if a value is encrypted with the current key
+func (k *Keyring) Current(value string) bool {
+	return strings.HasPrefix(value, Prefix+keyID(k.Keys[0])+":")
+}
+
+// DecryptEnv returns a copy of the environment variables with their values decrypted
+func (k *Keyring) DecryptEnv(env map[string]string) (map[string]string, error) {
+	var decrypted = map[string]string{}
+
+	for name, value := range env {
+		if IsEncrypted(value) {
+			var err error
+
+			if value, err = k.Decrypt(name, value); err != nil {
+				return nil, err
+			}
+		}
+
+		decrypted[name] = value
+	}
+
+	return decrypted, nil
+}
+
+// ReencryptEnv encrypts with the current key the values encrypted with older keys
+// Values already encrypted with the current key are kept, so they diff cleanly.
+func (k *Keyring) ReencryptEnv(env map[string]string) (changed bool, err error) {
+	for name, value := range env {
+		if !IsEncrypted(value) || k.Current(value) {
+			continue
+		}
+
+		if value, err = k.Decrypt(name, value); err != nil {
+			return changed, err
+		}
+
+		if env[name], err = k.Encrypt(name, value); err != nil {
+			return changed, err
+		}
+
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// Decrypted returns the environment variables of a project container ready to use
+// The keyring is only loaded when a value is encrypted.
+func Decrypted(projectID string, env map[string]string) (map[string]string, error) {
+	if !HasEncrypted(env) {
+		return env, nil
+	}
+
+	var k, err = Load(projectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k.DecryptEnv(env)
+}
+
+func (k *Keyring) find(id string) []byte {
+	for _, key := range k.Keys {
+		if keyID(key) == id {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func keyID(key []byte) string {
+	var sum = sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	var block, err = aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// redact hides a decrypted value from verbose messages, as is and JSON encoded
+func redact(value string) {
+	var encoded, _ = json.Marshal(value)
+	verbose.Redact(value, strings.Trim(string(encoded), `"`))
+}
@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wedeploy/cli/verbose"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	var k, err = New()
+
+	if err != nil {
+		panic(err)
+	}
+
+	var encrypted string
+
+	if encrypted, err = k.Encrypt("DB_PASSWORD", "s3cr3t"); err != nil {
+		t.Errorf("Expected no error, got %v instead", err)
+	}
+
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "s3cr3t") || !k.Current(encrypted) {
+		t.Errorf("Unexpected encrypted value %v", encrypted)
+	}
+
+	var plain string
+
+	if plain, err = k.Decrypt("DB_PASSWORD", encrypted); err != nil || plain != "s3cr3t" {
+		t.Errorf("Wanted s3cr3t, got %v, %v instead", plain, err)
+	}
+
+	if _, err = k.Decrypt("OTHER", encrypted); err == nil {
+		t.Errorf("Expected value encrypted for another name to fail")
+	}
+
+	var other, _ = New()
+
+	if _, err = other.Decrypt("DB_PASSWORD", encrypted); err != (DecryptError{"DB_PASSWORD", ErrUnknownKey}) {
+		t.Errorf("Expected unknown key error, got %v instead", err)
+	}
+}
+
+func TestDecryptRedacted(t *testing.T) {
+	var k, _ = New()
+	var encrypted, _ = k.Encrypt("TOKEN", `to"ken`)
+	var defaultErrStream = verbose.ErrStream
+	var out bytes.Buffer
+
+	verbose.Enabled = true
+	verbose.ErrStream = &out
+
+	if _, err := k.Decrypt("TOKEN", encrypted); err != nil {
+		panic(err)
+	}
+
+	verbose.Debug(`{"TOKEN": "to\"ken"}`, `to"ken`)
+
+	if want := `{"TOKEN": "********"} ********` + "\n"; out.String() != want {
+		t.Errorf("Wanted %v, got %v instead", want, out.String())
+	}
+
+	verbose.Enabled = false
+	verbose.ErrStream = defaultErrStream
+}
+
+func TestRotate(t *testing.T) {
+	var k, _ = New()
+	var env = map[string]string{
+		"PLAIN": "value",
+	}
+
+	env["SECRET"], _ = k.Encrypt("SECRET", "s3cr3t")
+
+	if err := k.Rotate(); err != nil {
+		panic(err)
+	}
+
+	var changed, err = k.ReencryptEnv(env)
+
+	if !changed || err != nil || !k.Current(env["SECRET"]) || env["PLAIN"] != "value" {
+		t.Errorf("Expected SECRET to be encrypted with the new key, got %v, %v", env, err)
+	}
+
+	var decrypted map[string]string
+
+	if decrypted, err = (&Keyring{k.Keys[:1]}).DecryptEnv(env); err != nil {
+		t.Errorf("Expected no error, got %v instead", err)
+	}
+
+	var want = map[string]string{
+		"PLAIN":  "value",
+		"SECRET": "s3cr3t",
+	}
+
+	if !reflect.DeepEqual(decrypted, want) {
+		t.Errorf("Wanted %v, got %v instead", want, decrypted)
+	}
+
+	if changed, _ = k.ReencryptEnv(env); changed {
+		t.Errorf("Expected values encrypted with the current key to be kept")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var defaultKeysDir = KeysDir
+	var dir, err = ioutil.TempDir("", "we-secrets")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+	KeysDir = dir
+
+	if _, err = Load("project"); err != ErrNoKey {
+		t.Errorf("Expected %v, got %v instead", ErrNoKey, err)
+	}
+
+	var k, _ = New()
+
+	if err = k.Save("project"); err != nil {
+		panic(err)
+	}
+
+	var loaded *Keyring
+
+	if loaded, err = Load("project"); err != nil || !reflect.DeepEqual(loaded, k) {
+		t.Errorf("Expected saved keyring to be loaded, got %v instead", err)
+	}
+
+	if err = os.Setenv(KeyEnv, FormatKey(k.Keys[0])+",invalid"); err != nil {
+		panic(err)
+	}
+
+	if _, err = Load("project"); err != ErrInvalidKey {
+		t.Errorf("Expected %v, got %v instead", ErrInvalidKey, err)
+	}
+
+	if err = os.Unsetenv(KeyEnv); err != nil {
+		panic(err)
+	}
+
+	KeysDir = defaultKeysDir
+}
+
+func TestDecryptedPlain(t *testing.T) {
+	var env = map[string]string{"A": "1"}
+	var got, err = Decrypted("no-keyring", env)
+
+	if err != nil || !reflect.DeepEqual(got, env) {
+		t.Errorf("Expected plain env to be used as is, got %v, %v instead", got, err)
+	}
+}
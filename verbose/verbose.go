@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
 var (
@@ -12,11 +14,41 @@ var (
 
 	// ErrStream is the stream for errors
 	ErrStream io.Writer = os.Stderr
+
+	redacted      = map[string]bool{}
+	redactedMutex sync.RWMutex
 )
 
+// RedactMask replaces redacted values on verbose messages
+const RedactMask = "********"
+
 // Debug prints verbose messages to stderr on verbose mode
 func Debug(a ...interface{}) {
 	if Enabled {
-		fmt.Fprintln(ErrStream, a...)
+		fmt.Fprint(ErrStream, redact(fmt.Sprintln(a...)))
+	}
+}
+
+// Redact hides values, such as decrypted secrets, from verbose messages
+func Redact(values ...string) {
+	redactedMutex.Lock()
+
+	for _, v := range values {
+		if v != "" {
+			redacted[v] = true
+		}
 	}
+
+	redactedMutex.Unlock()
+}
+
+func redact(msg string) string {
+	redactedMutex.RLock()
+	defer redactedMutex.RUnlock()
+
+	for v := range redacted {
+		msg = strings.Replace(msg, v, RedactMask, -1)
+	}
+
+	return msg
 }
@@ -36,3 +36,17 @@ func TestDebugOff(t *testing.T) {
 		t.Errorf("Wanted no debug, got %s instead", got)
 	}
 }
+
+func TestDebugRedact(t *testing.T) {
+	bufErrStream.Reset()
+	Enabled = true
+	Redact("s3cr3t", "")
+	Debug("password:", "s3cr3t")
+
+	var want = "password: ********\n"
+	if got := bufErrStream.String(); got != want {
+		t.Errorf("Wanted %s, got %s instead", want, got)
+	}
+
+	Enabled = false
+}